@@ -0,0 +1,247 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// The administrative commands run concurrently on every server of the client,
+// or only on the servers given by their addresses. The errors of the servers
+// which failed are joined, the ones reported by a server are an *Error
+// holding its address.
+
+// FlushAll invalidates all the items after the delay.
+func (c *Client) FlushAll(delay time.Duration, addrs ...string) error {
+	return c.flushAll(context.Background(), delay, addrs)
+}
+
+// FlushAllContext is like FlushAll but honours the deadline and cancellation of ctx.
+func (c *Client) FlushAllContext(ctx context.Context, delay time.Duration, addrs ...string) error {
+	return c.flushAll(ctx, delay, addrs)
+}
+
+func (c *Client) flushAll(ctx context.Context, delay time.Duration, addrs []string) error {
+	defer c.near.clear()
+
+	return c.eachServer(ctx, addrs, func(cn *Connection) error {
+		return c.adminFn("flush_all", cn, func() error {
+			return c.protocol.flushAll(cn, delay)
+		})
+	})
+}
+
+// Version returns the version of the servers keyed by their address.
+func (c *Client) Version(addrs ...string) (map[string]string, error) {
+	return c.version(context.Background(), addrs)
+}
+
+// VersionContext is like Version but honours the deadline and cancellation of ctx.
+func (c *Client) VersionContext(ctx context.Context, addrs ...string) (map[string]string, error) {
+	return c.version(ctx, addrs)
+}
+
+func (c *Client) version(ctx context.Context, addrs []string) (map[string]string, error) {
+	var mu sync.Mutex
+	versions := make(map[string]string)
+
+	err := c.eachServer(ctx, addrs, func(cn *Connection) error {
+		return c.adminFn("version", cn, func() error {
+			v, err := c.protocol.version(cn)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			versions[cn.pool.addr.String()] = v
+			mu.Unlock()
+
+			return nil
+		})
+	})
+
+	return versions, err
+}
+
+// Verbosity sets the logging level of the servers.
+func (c *Client) Verbosity(level int, addrs ...string) error {
+	return c.verbosity(context.Background(), level, addrs)
+}
+
+// VerbosityContext is like Verbosity but honours the deadline and cancellation of ctx.
+func (c *Client) VerbosityContext(ctx context.Context, level int, addrs ...string) error {
+	return c.verbosity(ctx, level, addrs)
+}
+
+func (c *Client) verbosity(ctx context.Context, level int, addrs []string) error {
+	return c.eachServer(ctx, addrs, func(cn *Connection) error {
+		return c.adminFn("verbosity", cn, func() error {
+			return c.protocol.verbosity(cn, level)
+		})
+	})
+}
+
+// CacheMemLimit changes the memory limit of the servers to mb megabytes.
+// It is not supported by the binary protocol.
+func (c *Client) CacheMemLimit(mb int, addrs ...string) error {
+	return c.cacheMemLimit(context.Background(), mb, addrs)
+}
+
+// CacheMemLimitContext is like CacheMemLimit but honours the deadline and cancellation of ctx.
+func (c *Client) CacheMemLimitContext(ctx context.Context, mb int, addrs ...string) error {
+	return c.cacheMemLimit(ctx, mb, addrs)
+}
+
+func (c *Client) cacheMemLimit(ctx context.Context, mb int, addrs []string) error {
+	return c.eachServer(ctx, addrs, func(cn *Connection) error {
+		return c.adminFn("cache_memlimit", cn, func() error {
+			return c.protocol.cacheMemLimit(cn, mb)
+		})
+	})
+}
+
+// Shutdown stops the servers, they have to be started with shutdown enabled.
+// It is not supported by the binary protocol.
+func (c *Client) Shutdown(addrs ...string) error {
+	return c.shutdown(context.Background(), addrs)
+}
+
+// ShutdownContext is like Shutdown but honours the deadline and cancellation of ctx.
+func (c *Client) ShutdownContext(ctx context.Context, addrs ...string) error {
+	return c.shutdown(ctx, addrs)
+}
+
+func (c *Client) shutdown(ctx context.Context, addrs []string) error {
+	return c.eachServer(ctx, addrs, func(cn *Connection) error {
+		err := c.protocol.shutdown(cn)
+		if err != nil {
+			c.putBackConnection(cn, err)
+			return cn.wrapError("shutdown", err)
+		}
+
+		c.closeConnection(cn)
+
+		return nil
+	})
+}
+
+func (c *Client) adminFn(verb string, cn *Connection, fn func() error) error {
+	err := fn()
+	c.putBackConnection(cn, err)
+
+	return cn.wrapError(verb, err)
+}
+
+// eachServer calls fn concurrently with a connection to every server
+// or to the given ones. fn has to put the connection back.
+func (c *Client) eachServer(ctx context.Context, addrs []string, fn func(*Connection) error) error {
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	called := make(map[string]bool)
+
+	for attempt := 0; ; attempt++ {
+		targets, err := c.adminTargets(addrs)
+		if err != nil {
+			return err
+		}
+
+		var (
+			wg      sync.WaitGroup
+			changed bool
+		)
+
+		for _, addr := range targets {
+			if called[addr] {
+				continue
+			}
+			called[addr] = true
+
+			wg.Add(1)
+
+			go func(addr string) {
+				defer wg.Done()
+
+				cn, err := c.getFreeConn(ctx, addr)
+				if err == nil {
+					err = fn(cn)
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				// A server removed since the servers were listed is left out,
+				// the servers added in its place are called once more.
+				if errors.Is(err, ErrPoolClosed) && attempt == 0 && len(addrs) == 0 {
+					changed = true
+					return
+				}
+
+				errs = append(errs, err)
+			}(addr)
+		}
+
+		wg.Wait()
+
+		if !changed {
+			return errors.Join(errs...)
+		}
+	}
+}
+
+// adminTargets returns the addresses of all the servers when none are given,
+// otherwise it checks that the given ones belong to the client.
+func (c *Client) adminTargets(addrs []string) ([]string, error) {
+	var targets []string
+
+	if len(addrs) == 0 {
+		err := c.router.Each(func(addr net.Addr) error {
+			targets = append(targets, addr.String())
+			return nil
+		})
+
+		return targets, err
+	}
+
+	resolved, err := resolveAddrs(addrs)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, addr := range resolved {
+		if _, ok := c.pools[addr.String()]; !ok {
+			return nil, &Error{Kind: ErrNoServers, Addr: addr.String()}
+		}
+		targets = append(targets, addr.String())
+	}
+
+	return targets, nil
+}
@@ -0,0 +1,144 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"errors"
+	"net"
+	"os/exec"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache Admin Commands Tests", Label("AdminCommands"), func() {
+	var mc *Client
+
+	BeforeEach(func() {
+		mc = New([]string{defaultAddr, secondAddr}, 1)
+		Expect(mc).ToNot(BeNil())
+	})
+
+	AfterEach(func() {
+		mc.Close()
+	})
+
+	It("Admin commands run on every server", func() {
+		By("Version returns the version of every server")
+		versions, err := mc.Version()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(versions).To(HaveLen(2))
+		Expect(versions[defaultAddr]).ToNot(BeEmpty())
+		Expect(versions[secondAddr]).ToNot(BeEmpty())
+
+		By("FlushAll invalidates the items on every server")
+		keys := []string{"admin_1", "admin_2", "admin_3", "admin_4", "admin_5", "admin_6"}
+		for _, key := range keys {
+			Expect(mc.Set(&Item{Key: key, Value: []byte("value"), Expiration: time.Minute})).To(Succeed())
+		}
+		Expect(mc.FlushAll(0)).To(Succeed())
+		items, err := mc.GetMulti(keys)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(items).To(BeEmpty())
+
+		By("Verbosity and CacheMemLimit are accepted")
+		Expect(mc.Verbosity(1)).To(Succeed())
+		Expect(mc.CacheMemLimit(64)).To(Succeed())
+
+		By("Shutdown fails unless the servers enable it")
+		err = mc.Shutdown()
+		Expect(err).To(MatchError(ErrError))
+
+		var merr *Error
+		Expect(errors.As(err, &merr)).To(BeTrue())
+		Expect(merr.Verb).To(Equal("shutdown"))
+		Expect(merr.Msg).To(ContainSubstring("shutdown not enabled"))
+	})
+
+	It("Admin commands run on the named servers only", func() {
+		versions, err := mc.Version(secondAddr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(versions).To(HaveLen(1))
+		Expect(versions).To(HaveKey(secondAddr))
+
+		Expect(mc.Set(&Item{Key: "admin_key", Value: []byte("value")})).To(Succeed())
+		addr, err := mc.router.PickServer("admin_key")
+		Expect(err).ToNot(HaveOccurred())
+
+		other := defaultAddr
+		if addr.String() == defaultAddr {
+			other = secondAddr
+		}
+		Expect(mc.FlushAll(0, other)).To(Succeed())
+		_, err = mc.Get("admin_key")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(mc.FlushAll(0, addr.String())).To(Succeed())
+		_, err = mc.Get("admin_key")
+		Expect(err).To(MatchError(ErrCacheMiss))
+
+		By("Servers not known to the client are rejected")
+		Expect(mc.Verbosity(1, "127.0.0.1:1")).To(MatchError(ErrNoServers))
+	})
+
+	It("Shutdown stops a server which enables it", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		addr := l.Addr().String()
+		_, port, _ := net.SplitHostPort(addr)
+		l.Close()
+
+		cmd := exec.Command("memcached", "--port="+port, "--listen="+defaultIP, "--enable-shutdown")
+		Expect(cmd.Start()).To(Succeed())
+		defer cmd.Process.Kill()
+
+		Eventually(func() error {
+			nc, err := net.Dial("tcp", addr)
+			if err == nil {
+				nc.Close()
+			}
+			return err
+		}).Should(Succeed())
+
+		mc := New([]string{addr}, 1)
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		Expect(mc.Shutdown(addr)).To(Succeed())
+		Expect(cmd.Wait()).To(Succeed())
+	})
+
+	It("Commands missing from the binary protocol are not supported", func() {
+		mc := New([]string{defaultAddr}, 1, WithProtocol(BinaryProtocol))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		versions, err := mc.Version()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(versions).To(HaveKey(defaultAddr))
+		Expect(mc.Verbosity(1)).To(Succeed())
+		Expect(mc.CacheMemLimit(64)).To(MatchError(ErrNotSupported))
+		Expect(mc.Shutdown()).To(MatchError(ErrNotSupported))
+	})
+})
@@ -0,0 +1,236 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// SetMulti stores all the items. The items are grouped by server and the
+// commands for a server are sent at once over a single connection.
+// It returns the errors of the items which were not stored by their key,
+// the result is nil when all of them were stored. With the text protocol
+// the items are sent as meta commands in the quiet mode, so only the failed
+// ones are answered, which needs memcached 1.6 or newer.
+func (c *Client) SetMulti(items []*Item) map[string]error {
+	return c.setMulti(context.Background(), items)
+}
+
+// SetMultiContext is like SetMulti but honours the deadline and cancellation of ctx.
+func (c *Client) SetMultiContext(ctx context.Context, items []*Item) map[string]error {
+	return c.setMulti(ctx, items)
+}
+
+func (c *Client) setMulti(ctx context.Context, items []*Item) map[string]error {
+	defer c.near.invalidateItems(items)
+
+	itemErrs := make(map[string]error)
+	stored := make([]*Item, 0, len(items))
+
+	for _, item := range items {
+		compressed, err := c.compress("set", item)
+		if err != nil {
+			itemErrs[item.Key] = err
+			continue
+		}
+
+		// Chunked values take several round trips, they are not batched.
+		key, err := c.serverKey(item.Key)
+		if err != nil {
+			itemErrs[item.Key] = err
+			continue
+		}
+
+		if chunked, err := c.storeChunks(ctx, "set", key, compressed); chunked || err != nil {
+			if err != nil {
+				itemErrs[item.Key] = err
+			}
+			continue
+		}
+
+		stored = append(stored, compressed)
+	}
+
+	errs := c.storeBatch(ctx, stored)
+	if len(itemErrs) == 0 {
+		return errs
+	}
+
+	for key, err := range errs {
+		itemErrs[key] = err
+	}
+
+	return itemErrs
+}
+
+// storeBatch sets the items like SetMulti without compressing them.
+func (c *Client) storeBatch(ctx context.Context, items []*Item) map[string]error {
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+
+	return c.batch(ctx, "set", keys, func(cn *Connection, idx []int, keys []string) (map[int]error, error) {
+		batch := make([]*Item, len(idx))
+		for i, j := range idx {
+			batch[i] = withKey(items[j], keys[i])
+		}
+
+		return c.protocol.storeMulti(cn, batch)
+	})
+}
+
+// DeleteMulti removes all the keys like SetMulti stores the items.
+// Missing keys are reported with ErrCacheMiss.
+func (c *Client) DeleteMulti(keys []string) map[string]error {
+	return c.deleteMulti(context.Background(), keys)
+}
+
+// DeleteMultiContext is like DeleteMulti but honours the deadline and cancellation of ctx.
+func (c *Client) DeleteMultiContext(ctx context.Context, keys []string) map[string]error {
+	return c.deleteMulti(ctx, keys)
+}
+
+func (c *Client) deleteMulti(ctx context.Context, keys []string) map[string]error {
+	defer c.near.invalidate(keys...)
+
+	return c.batch(ctx, "delete", keys, func(cn *Connection, idx []int, keys []string) (map[int]error, error) {
+		return c.protocol.deleteMulti(cn, keys)
+	})
+}
+
+// TouchMulti updates the expiration of all the keys like SetMulti stores the items,
+// also with the meta commands in the quiet mode. Missing keys are reported with ErrCacheMiss.
+func (c *Client) TouchMulti(keys []string, ttl time.Duration) map[string]error {
+	return c.touchMulti(context.Background(), keys, ttl)
+}
+
+// TouchMultiContext is like TouchMulti but honours the deadline and cancellation of ctx.
+func (c *Client) TouchMultiContext(ctx context.Context, keys []string, ttl time.Duration) map[string]error {
+	return c.touchMulti(ctx, keys, ttl)
+}
+
+func (c *Client) touchMulti(ctx context.Context, keys []string, ttl time.Duration) map[string]error {
+	return c.batch(ctx, "touch", keys, func(cn *Connection, idx []int, keys []string) (map[int]error, error) {
+		return c.protocol.touchMulti(cn, keys, ttl)
+	})
+}
+
+// batch groups the keys by server and calls fn concurrently for every server
+// with the indexes of its keys and their server keys. fn returns the errors
+// by the position in idx. A failed connection fails all the keys of the server.
+func (c *Client) batch(ctx context.Context, verb string, keys []string, fn func(cn *Connection, idx []int, keys []string) (map[int]error, error)) map[string]error {
+	errs := make(map[string]error)
+	serverKeys := make([]string, len(keys))
+	pending := make([]int, 0, len(keys))
+
+	for i, key := range keys {
+		skey, err := c.serverKey(key)
+		if err != nil {
+			errs[key] = err
+			continue
+		}
+		serverKeys[i] = skey
+		pending = append(pending, i)
+	}
+
+	var mu sync.Mutex
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		idxByAddr := make(map[string][]int)
+
+		for _, i := range pending {
+			addr, err := c.pickServer(serverKeys[i])
+			if err != nil {
+				errs[keys[i]] = err
+				continue
+			}
+
+			idxByAddr[addr.String()] = append(idxByAddr[addr.String()], i)
+		}
+
+		var (
+			wg    sync.WaitGroup
+			retry []int
+		)
+
+		for addr, idx := range idxByAddr {
+			wg.Add(1)
+
+			go func(addr string, idx []int) {
+				defer wg.Done()
+
+				var keyErrs map[int]error
+
+				cn, err := c.getFreeConn(ctx, addr)
+				if err == nil {
+					keyErrs, err = fn(cn, idx, pickKeys(serverKeys, idx))
+					c.putBackConnection(cn, err)
+					err = cn.wrapError(verb, err)
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				// The server might have been removed since it was picked,
+				// so the servers for its keys are picked once more.
+				if errors.Is(err, ErrPoolClosed) && attempt == 0 {
+					retry = append(retry, idx...)
+					return
+				}
+
+				if err != nil {
+					for _, i := range idx {
+						errs[keys[i]] = err
+					}
+					return
+				}
+
+				for i, err := range keyErrs {
+					errs[keys[idx[i]]] = cn.wrapError(verb, err)
+				}
+			}(addr, idx)
+		}
+
+		wg.Wait()
+		pending = retry
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+func pickKeys(keys []string, idx []int) []string {
+	res := make([]string, len(idx))
+	for i, j := range idx {
+		res[i] = keys[j]
+	}
+
+	return res
+}
@@ -0,0 +1,189 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache Batch Tests", Label("Batch"), func() {
+	for _, proto := range []ProtocolType{TextProtocol, BinaryProtocol} {
+		proto := proto
+
+		It(fmt.Sprintf("Batches are pipelined per server with protocol %d", proto), func() {
+			mc := New([]string{defaultAddr, secondAddr}, 1, WithProtocol(proto))
+			Expect(mc).ToNot(BeNil())
+			defer mc.Close()
+
+			var (
+				items []*Item
+				keys  []string
+			)
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("batch_%d_%d", proto, i)
+				items = append(items, &Item{Key: key, Value: []byte(key), Expiration: time.Minute, Flags: 4})
+				keys = append(keys, key)
+			}
+
+			By("SetMulti stores every item")
+			Expect(mc.SetMulti(items)).To(BeNil())
+			res, err := mc.GetMulti(keys)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(len(keys)))
+			Expect(res[keys[7]].Value).To(Equal([]byte(keys[7])))
+			Expect(res[keys[7]].Flags).To(Equal(int32(4)))
+
+			By("Only the failed items are reported")
+			tooLarge := &Item{Key: "batch_too_large", Value: bytes.Repeat([]byte("x"), 2<<20)}
+			errs := mc.SetMulti([]*Item{items[0], tooLarge, {Key: "invalid key"}, items[1]})
+			Expect(errs).To(HaveLen(2))
+			Expect(errs["batch_too_large"]).To(MatchError(ErrServerError))
+			Expect(errs["invalid key"]).To(HaveOccurred())
+
+			By("TouchMulti reports the missing keys")
+			errs = mc.TouchMulti(append(keys[:10:10], "batch_missing"), time.Hour)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs["batch_missing"]).To(MatchError(ErrCacheMiss))
+
+			By("DeleteMulti removes every key")
+			errs = mc.DeleteMulti(append(keys[:100:100], "batch_missing"))
+			Expect(errs).To(HaveLen(1))
+			Expect(errs["batch_missing"]).To(MatchError(ErrCacheMiss))
+			res, err = mc.GetMulti(keys)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(100))
+
+			Expect(mc.DeleteMulti(keys[100:])).To(BeNil())
+		})
+	}
+
+	It("Only the failed commands are answered in the quiet mode", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer l.Close()
+
+		// The server answers only the sets of the keys starting with
+		// "fail" and the noop, like memcached does in the quiet mode.
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+
+				fields := strings.Fields(line)
+				switch {
+				case fields[0] == "mn":
+					conn.Write([]byte("MN\r\n"))
+				case fields[0] == "ms":
+					r.ReadString('\n')
+					if !strings.HasPrefix(fields[1], "fail") {
+						continue
+					}
+					for _, f := range fields {
+						if f[0] == 'O' {
+							conn.Write([]byte("NS " + f + "\r\n"))
+						}
+					}
+				}
+			}
+		}()
+
+		mc := New([]string{l.Addr().String()}, 1)
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		errs := mc.SetMulti([]*Item{
+			{Key: "ok_1", Value: []byte("value")},
+			{Key: "fail_1", Value: []byte("value")},
+			{Key: "ok_2", Value: []byte("value")},
+			{Key: "fail_2", Value: []byte("value")},
+		})
+		Expect(errs).To(HaveLen(2))
+		Expect(errs["fail_1"]).To(MatchError(ErrNotStored))
+		Expect(errs["fail_2"]).To(MatchError(ErrNotStored))
+	})
+
+	It("An error line fails the unanswered items of a pipelined batch", func() {
+		mc := New([]string{defaultAddr}, 1, WithPipelining(1))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		tooLarge := &Item{Key: "pipelined_too_large", Value: bytes.Repeat([]byte("x"), 2<<20)}
+		stored := &Item{Key: "pipelined_stored", Value: []byte("value")}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				errs := mc.SetMulti([]*Item{stored, tooLarge})
+				Expect(errs["pipelined_too_large"]).To(MatchError(ErrServerError))
+				Expect(mc.Set(&Item{Key: "pipelined_after", Value: []byte("value")})).To(Succeed())
+			}()
+		}
+		wg.Wait()
+
+		it, err := mc.Get("pipelined_after")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("value")))
+	})
+
+	It("A failed server fails its keys only", func() {
+		mc := New([]string{defaultAddr, "127.0.0.1:1"}, 1)
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		var items []*Item
+		for i := 0; i < 20; i++ {
+			items = append(items, &Item{Key: fmt.Sprintf("batch_failed_%d", i), Value: []byte("value")})
+		}
+
+		errs := mc.SetMulti(items)
+		Expect(errs).ToNot(BeEmpty())
+		Expect(len(errs)).To(BeNumerically("<", len(items)))
+		for key := range errs {
+			addr, err := mc.router.PickServer(key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(addr.String()).To(Equal("127.0.0.1:1"))
+		}
+	})
+})
@@ -0,0 +1,602 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	binaryReqMagic  = 0x80
+	binaryResMagic  = 0x81
+	binaryHeaderLen = 24
+)
+
+type binaryOpcode uint8
+
+const (
+	opGet       binaryOpcode = 0x00
+	opSet       binaryOpcode = 0x01
+	opAdd       binaryOpcode = 0x02
+	opReplace   binaryOpcode = 0x03
+	opDelete    binaryOpcode = 0x04
+	opIncrement binaryOpcode = 0x05
+	opDecrement binaryOpcode = 0x06
+	opFlush     binaryOpcode = 0x08
+	opNoop      binaryOpcode = 0x0a
+	opVersion   binaryOpcode = 0x0b
+	opGetKQ     binaryOpcode = 0x0d
+	opAppend    binaryOpcode = 0x0e
+	opPrepend   binaryOpcode = 0x0f
+	opStat      binaryOpcode = 0x10
+	opSetQ      binaryOpcode = 0x11
+	opDeleteQ   binaryOpcode = 0x14
+	opVerbosity binaryOpcode = 0x1b
+	opTouch     binaryOpcode = 0x1c
+	opGAT       binaryOpcode = 0x1d
+	opSASLAuth  binaryOpcode = 0x21
+	opGATKQ     binaryOpcode = 0x24
+)
+
+type binaryStatus uint16
+
+const (
+	statusNoError        binaryStatus = 0x0000
+	statusKeyNotFound    binaryStatus = 0x0001
+	statusKeyExists      binaryStatus = 0x0002
+	statusValueTooLarge  binaryStatus = 0x0003
+	statusInvalidArgs    binaryStatus = 0x0004
+	statusNotStored      binaryStatus = 0x0005
+	statusNonNumeric     binaryStatus = 0x0006
+	statusAuthError      binaryStatus = 0x0020
+	statusUnknownCommand binaryStatus = 0x0081
+	statusOutOfMemory    binaryStatus = 0x0082
+)
+
+// binaryStoreOps maps the storage verbs to their opcodes.
+var binaryStoreOps = map[string]binaryOpcode{
+	"set":     opSet,
+	"add":     opAdd,
+	"replace": opReplace,
+	"append":  opAppend,
+	"prepend": opPrepend,
+	"cas":     opSet,
+}
+
+// binaryPacket is a single request or response of the binary protocol.
+type binaryPacket struct {
+	opcode binaryOpcode
+	status binaryStatus
+	opaque uint32
+	cas    uint64
+	extras []byte
+	key    string
+	value  []byte
+}
+
+// binaryProtocol implements the binary protocol.
+type binaryProtocol struct{}
+
+func (binaryProtocol) store(cn *Connection, verb string, item *Item) error {
+	op, ok := binaryStoreOps[verb]
+	if !ok {
+		return ErrNotSupported
+	}
+
+	// A zero CAS value is sent as no CAS value at all, which would store
+	// the item unconditionally. It never matches an item, so the result
+	// of the text protocol is returned without storing it.
+	if verb == "cas" && item.CAS == 0 {
+		res, err := roundTripBinary(cn, &binaryPacket{opcode: opGet, key: item.Key})
+		if err != nil {
+			return err
+		}
+
+		if err := binaryStatusError(res); err != nil {
+			return err
+		}
+
+		return ErrExists
+	}
+
+	req := binaryStorePacket(op, item)
+	if verb == "cas" {
+		req.cas = uint64(item.CAS)
+	}
+
+	res, err := roundTripBinary(cn, req)
+	if err != nil {
+		return err
+	}
+
+	// Report the same errors as the text protocol does.
+	switch {
+	case verb == "add" && res.status == statusKeyExists:
+		return ErrNotStored
+	case verb == "replace" && res.status == statusKeyNotFound:
+		return ErrNotStored
+	}
+
+	return binaryStatusError(res)
+}
+
+func (binaryProtocol) storeMulti(cn *Connection, items []*Item) (map[int]error, error) {
+	reqs := make([]*binaryPacket, len(items))
+	for i, item := range items {
+		reqs[i] = binaryStorePacket(opSetQ, item)
+	}
+
+	return roundTripQuiet(cn, reqs)
+}
+
+func (binaryProtocol) deleteMulti(cn *Connection, keys []string) (map[int]error, error) {
+	reqs := make([]*binaryPacket, len(keys))
+	for i, key := range keys {
+		reqs[i] = &binaryPacket{opcode: opDeleteQ, key: key}
+	}
+
+	return roundTripQuiet(cn, reqs)
+}
+
+// There is no quiet touch, every touch is answered.
+func (binaryProtocol) touchMulti(cn *Connection, keys []string, ttl time.Duration) (map[int]error, error) {
+	extras := binaryExpiration(ttl)
+
+	reqs := make([]*binaryPacket, len(keys))
+	for i, key := range keys {
+		reqs[i] = &binaryPacket{opcode: opTouch, key: key, extras: extras}
+	}
+
+	return roundTripQuiet(cn, reqs)
+}
+
+func binaryStorePacket(op binaryOpcode, item *Item) *binaryPacket {
+	req := &binaryPacket{
+		opcode: op,
+		key:    item.Key,
+		value:  item.Value,
+	}
+
+	// Append and prepend do not take any extras.
+	if op != opAppend && op != opPrepend {
+		req.extras = make([]byte, 8)
+		binary.BigEndian.PutUint32(req.extras[0:4], uint32(item.Flags))
+		binary.BigEndian.PutUint32(req.extras[4:8], uint32(item.Expiration.Seconds()))
+	}
+
+	return req
+}
+
+func (binaryProtocol) retrieve(cn *Connection, verb string, key string, ttl time.Duration) (*Item, error) {
+	req := &binaryPacket{opcode: opGet, key: key}
+	if verb == "gat" || verb == "gats" {
+		req.opcode = opGAT
+		req.extras = binaryExpiration(ttl)
+	}
+
+	res, err := roundTripBinary(cn, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := binaryStatusError(res); err != nil {
+		return nil, err
+	}
+
+	return binaryItem(verb, key, res)
+}
+
+func (binaryProtocol) retrieveMulti(cn *Connection, verb string, keys []string, ttl time.Duration) (map[string]*Item, error) {
+	op := opGetKQ
+	var extras []byte
+	if verb == "gat" || verb == "gats" {
+		op = opGATKQ
+		extras = binaryExpiration(ttl)
+	}
+
+	// Quiet gets only reply on a hit, the final noop tells us we are done.
+	for _, key := range keys {
+		cn.opaque++
+		if err := writeBinaryPacket(cn.rw.Writer, &binaryPacket{opcode: op, key: key, extras: extras, opaque: cn.opaque}); err != nil {
+			return nil, err
+		}
+	}
+
+	cn.opaque++
+	noop := &binaryPacket{opcode: opNoop, opaque: cn.opaque}
+	if err := writeBinaryPacket(cn.rw.Writer, noop); err != nil {
+		return nil, err
+	}
+
+	if err := cn.flush(); err != nil {
+		return nil, err
+	}
+
+	items := make(map[string]*Item, len(keys))
+	for {
+		res, err := readBinaryPacket(cn.rw.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.opcode == opNoop && res.opaque == noop.opaque {
+			return items, nil
+		}
+
+		if res.opcode != op {
+			return nil, malformedResponse("binary response does not match the request")
+		}
+
+		if res.status == statusKeyNotFound {
+			continue
+		}
+
+		if err := binaryStatusError(res); err != nil {
+			return nil, err
+		}
+
+		it, err := binaryItem(verb, res.key, res)
+		if err != nil {
+			return nil, err
+		}
+		items[it.Key] = it
+	}
+}
+
+func (binaryProtocol) delete(cn *Connection, key string) error {
+	res, err := roundTripBinary(cn, &binaryPacket{opcode: opDelete, key: key})
+	if err != nil {
+		return err
+	}
+
+	return binaryStatusError(res)
+}
+
+// deleteCAS removes the item only if its CAS value was not changed.
+func (binaryProtocol) deleteCAS(cn *Connection, key string, cas int64) error {
+	res, err := roundTripBinary(cn, &binaryPacket{opcode: opDelete, key: key, cas: uint64(cas)})
+	if err != nil {
+		return err
+	}
+
+	return binaryStatusError(res)
+}
+
+func (binaryProtocol) touch(cn *Connection, key string, ttl time.Duration) error {
+	res, err := roundTripBinary(cn, &binaryPacket{opcode: opTouch, key: key, extras: binaryExpiration(ttl)})
+	if err != nil {
+		return err
+	}
+
+	return binaryStatusError(res)
+}
+
+func (binaryProtocol) incrDecr(cn *Connection, verb string, key string, delta uint64) (uint64, error) {
+	op := opIncrement
+	if verb == "decr" {
+		op = opDecrement
+	}
+
+	// The expiration of all ones tells the server not to create missing items.
+	extras := make([]byte, 20)
+	binary.BigEndian.PutUint64(extras[0:8], delta)
+	binary.BigEndian.PutUint32(extras[16:20], 0xffffffff)
+
+	res, err := roundTripBinary(cn, &binaryPacket{opcode: op, key: key, extras: extras})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := binaryStatusError(res); err != nil {
+		return 0, err
+	}
+
+	if len(res.value) != 8 {
+		return 0, malformedResponse(fmt.Sprintf("incr/decr response of %d bytes", len(res.value)))
+	}
+
+	return binary.BigEndian.Uint64(res.value), nil
+}
+
+func (binaryProtocol) version(cn *Connection) (string, error) {
+	res, err := roundTripBinary(cn, &binaryPacket{opcode: opVersion})
+	if err != nil {
+		return "", err
+	}
+
+	if err := binaryStatusError(res); err != nil {
+		return "", err
+	}
+
+	return string(res.value), nil
+}
+
+func (binaryProtocol) flushAll(cn *Connection, delay time.Duration) error {
+	res, err := roundTripBinary(cn, &binaryPacket{opcode: opFlush, extras: binaryExpiration(delay)})
+	if err != nil {
+		return err
+	}
+
+	return binaryStatusError(res)
+}
+
+func (binaryProtocol) verbosity(cn *Connection, level int) error {
+	extras := make([]byte, 4)
+	binary.BigEndian.PutUint32(extras, uint32(level))
+
+	res, err := roundTripBinary(cn, &binaryPacket{opcode: opVerbosity, extras: extras})
+	if err != nil {
+		return err
+	}
+
+	return binaryStatusError(res)
+}
+
+// auth sends the credentials in the clear, as the PLAIN mechanism does.
+func (binaryProtocol) auth(cn *Connection, username, password string) error {
+	res, err := roundTripBinary(cn, &binaryPacket{
+		opcode: opSASLAuth,
+		key:    "PLAIN",
+		value:  []byte("\x00" + username + "\x00" + password),
+	})
+	if err != nil {
+		return err
+	}
+
+	return binaryStatusError(res)
+}
+
+func (binaryProtocol) stats(cn *Connection, group string) (map[string]string, error) {
+	cn.opaque++
+	req := &binaryPacket{opcode: opStat, key: group, opaque: cn.opaque}
+
+	if err := writeBinaryPacket(cn.rw.Writer, req); err != nil {
+		return nil, err
+	}
+
+	if err := cn.flush(); err != nil {
+		return nil, err
+	}
+
+	// Every statistic comes in its own response, an empty key ends them.
+	stats := make(map[string]string)
+	for {
+		res, err := readBinaryPacket(cn.rw.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.opcode != opStat || res.opaque != req.opaque {
+			return nil, malformedResponse("binary response does not match the request")
+		}
+
+		if err := binaryStatusError(res); err != nil {
+			return nil, err
+		}
+
+		if res.key == "" {
+			return stats, nil
+		}
+
+		stats[res.key] = string(res.value)
+	}
+}
+
+// The binary protocol has no cache_memlimit and shutdown commands.
+func (binaryProtocol) cacheMemLimit(cn *Connection, mb int) error {
+	return ErrNotSupported
+}
+
+func (binaryProtocol) shutdown(cn *Connection) error {
+	return ErrNotSupported
+}
+
+// binaryExpiration encodes the expiration extras of gat and touch.
+func binaryExpiration(ttl time.Duration) []byte {
+	extras := make([]byte, 4)
+	binary.BigEndian.PutUint32(extras, uint32(ttl.Seconds()))
+
+	return extras
+}
+
+// binaryItem builds an item out of a get response.
+func binaryItem(verb, key string, res *binaryPacket) (*Item, error) {
+	if len(res.extras) != 4 {
+		return nil, malformedResponse(fmt.Sprintf("get response extras of %d bytes", len(res.extras)))
+	}
+
+	it := &Item{
+		Key:   key,
+		Value: res.value,
+		Flags: int32(binary.BigEndian.Uint32(res.extras)),
+	}
+
+	if verb == "gets" || verb == "gats" {
+		it.CAS = int64(res.cas)
+	}
+
+	return it, nil
+}
+
+func roundTripBinary(cn *Connection, req *binaryPacket) (*binaryPacket, error) {
+	cn.opaque++
+	req.opaque = cn.opaque
+
+	if err := writeBinaryPacket(cn.rw.Writer, req); err != nil {
+		return nil, err
+	}
+
+	if err := cn.flush(); err != nil {
+		return nil, err
+	}
+
+	res, err := readBinaryPacket(cn.rw.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.opcode != req.opcode || res.opaque != req.opaque {
+		return nil, malformedResponse("binary response does not match the request")
+	}
+
+	return res, nil
+}
+
+// roundTripQuiet sends the requests followed by a noop with a single flush.
+// Quiet requests are only answered on a failure, the noop response tells us
+// all the requests were processed. The errors are returned by the index
+// of the request they belong to.
+func roundTripQuiet(cn *Connection, reqs []*binaryPacket) (map[int]error, error) {
+	base := cn.opaque
+
+	for _, req := range reqs {
+		cn.opaque++
+		req.opaque = cn.opaque
+		if err := writeBinaryPacket(cn.rw.Writer, req); err != nil {
+			return nil, err
+		}
+	}
+
+	cn.opaque++
+	noop := &binaryPacket{opcode: opNoop, opaque: cn.opaque}
+	if err := writeBinaryPacket(cn.rw.Writer, noop); err != nil {
+		return nil, err
+	}
+
+	if err := cn.flush(); err != nil {
+		return nil, err
+	}
+
+	errs := make(map[int]error)
+	for {
+		res, err := readBinaryPacket(cn.rw.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.opcode == opNoop && res.opaque == noop.opaque {
+			return errs, nil
+		}
+
+		i := int(res.opaque - base - 1)
+		if i < 0 || i >= len(reqs) || res.opcode != reqs[i].opcode {
+			return nil, malformedResponse("binary response does not match the request")
+		}
+
+		if err := binaryStatusError(res); err != nil {
+			errs[i] = err
+		}
+	}
+}
+
+func writeBinaryPacket(w *bufio.Writer, p *binaryPacket) error {
+	var hdr [binaryHeaderLen]byte
+
+	hdr[0] = binaryReqMagic
+	hdr[1] = byte(p.opcode)
+	binary.BigEndian.PutUint16(hdr[2:4], uint16(len(p.key)))
+	hdr[4] = byte(len(p.extras))
+	binary.BigEndian.PutUint32(hdr[8:12], uint32(len(p.extras)+len(p.key)+len(p.value)))
+	binary.BigEndian.PutUint32(hdr[12:16], p.opaque)
+	binary.BigEndian.PutUint64(hdr[16:24], p.cas)
+
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(p.extras); err != nil {
+		return err
+	}
+	if _, err := w.WriteString(p.key); err != nil {
+		return err
+	}
+	if _, err := w.Write(p.value); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func readBinaryPacket(r *bufio.Reader) (*binaryPacket, error) {
+	var hdr [binaryHeaderLen]byte
+
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	if hdr[0] != binaryResMagic {
+		return nil, malformedResponse(fmt.Sprintf("binary response magic 0x%02x", hdr[0]))
+	}
+
+	keyLen := int(binary.BigEndian.Uint16(hdr[2:4]))
+	extrasLen := int(hdr[4])
+	bodyLen := int64(binary.BigEndian.Uint32(hdr[8:12]))
+
+	// The body is allocated before it is read,
+	// so its length is checked against the largest value.
+	if int64(keyLen+extrasLen) > bodyLen || bodyLen-int64(keyLen+extrasLen) > maxValueSize {
+		return nil, malformedResponse("binary response length")
+	}
+
+	body := make([]byte, bodyLen)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	return &binaryPacket{
+		opcode: binaryOpcode(hdr[1]),
+		status: binaryStatus(binary.BigEndian.Uint16(hdr[6:8])),
+		opaque: binary.BigEndian.Uint32(hdr[12:16]),
+		cas:    binary.BigEndian.Uint64(hdr[16:24]),
+		extras: body[:extrasLen],
+		key:    string(body[extrasLen : extrasLen+keyLen]),
+		value:  body[extrasLen+keyLen:],
+	}, nil
+}
+
+// binaryStatusError converts the response status to one of the client errors.
+func binaryStatusError(res *binaryPacket) error {
+	switch res.status {
+	case statusNoError:
+		return nil
+	case statusKeyNotFound:
+		return ErrCacheMiss
+	case statusKeyExists:
+		return ErrExists
+	case statusNotStored:
+		return ErrNotStored
+	case statusInvalidArgs, statusNonNumeric:
+		return &Error{Kind: ErrClientError, Msg: string(res.value)}
+	case statusValueTooLarge, statusOutOfMemory:
+		return &Error{Kind: ErrServerError, Msg: string(res.value)}
+	case statusUnknownCommand:
+		return ErrError
+	case statusAuthError:
+		return ErrAuthFailed
+	}
+
+	return &Error{Kind: ErrServerError, Msg: fmt.Sprintf("status 0x%04x: %s", uint16(res.status), res.value)}
+}
@@ -0,0 +1,233 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache Binary Protocol Tests", Label("BinaryProtocol"), func() {
+	var mc *Client
+	var binIt *Item
+	var binIncr *Item
+
+	BeforeEach(func() {
+		mc = New([]string{defaultAddr}, 1, WithProtocol(BinaryProtocol))
+
+		binIt = &Item{
+			Key:        "binary_hello",
+			Value:      []byte("binary\r\nworld"),
+			Expiration: time.Second * 60,
+			Flags:      7,
+		}
+		binIncr = &Item{
+			Key:        "binary_incr",
+			Value:      []byte("10"),
+			Expiration: time.Second * 60,
+		}
+	})
+
+	AfterEach(func() {
+		mc.Close()
+	})
+
+	It("Memcache Commands over the binary protocol", func() {
+		By("Get on a key that doesn't exist")
+		_, err := mc.Get("binary_missing")
+		Expect(err).To(MatchError(ErrCacheMiss))
+
+		By("Get after a Set command returns the correct value")
+		err = mc.Set(binIt)
+		Expect(err).ToNot(HaveOccurred())
+		res, err := mc.Gets(binIt.Key)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Value).To(Equal(binIt.Value))
+		Expect(res.Flags).To(Equal(binIt.Flags))
+		Expect(res.CAS).ToNot(BeZero())
+
+		By("Add on a key that exists is not stored")
+		err = mc.Add(binIt)
+		Expect(err).To(MatchError(ErrNotStored))
+
+		By("Append and prepend on a key that exists")
+		Expect(mc.Append(&Item{Key: binIt.Key, Value: []byte("!")})).To(Succeed())
+		Expect(mc.Prepend(&Item{Key: binIt.Key, Value: []byte("<")})).To(Succeed())
+		newIt, err := mc.Get(binIt.Key)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(newIt.Value)).To(Equal("<" + string(binIt.Value) + "!"))
+
+		By("CompareAndSwap with an outdated CAS value fails")
+		err = mc.CompareAndSwap(res)
+		Expect(err).To(MatchError(ErrExists))
+
+		By("CompareAndSwap without a CAS value fails like with the text protocol")
+		text := New([]string{defaultAddr}, 1)
+		defer text.Close()
+
+		for _, client := range []*Client{mc, text} {
+			err = client.CompareAndSwap(&Item{Key: binIt.Key, Value: []byte("overwritten")})
+			Expect(err).To(MatchError(ErrExists))
+			err = client.CompareAndSwap(&Item{Key: "binary_missing", Value: []byte("overwritten")})
+			Expect(err).To(MatchError(ErrCacheMiss))
+		}
+		newIt, err = mc.Get(binIt.Key)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(newIt.Value)).To(Equal("<" + string(binIt.Value) + "!"))
+
+		By("Delete removes the key")
+		Expect(mc.Delete(binIt.Key)).To(Succeed())
+		Expect(mc.Delete(binIt.Key)).To(MatchError(ErrCacheMiss))
+
+		By("Incr and Decr of a numerical value")
+		Expect(mc.Set(binIncr)).To(Succeed())
+		newVal, err := mc.Incr(binIncr.Key, 10)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(newVal).To(Equal(uint64(20)))
+		newVal, err = mc.Decr(binIncr.Key, 25)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(newVal).To(Equal(uint64(0)))
+		_, err = mc.Incr("binary_missing", 1)
+		Expect(err).To(MatchError(ErrCacheMiss))
+
+		By("GetMulti returns only the existing keys")
+		items, err := mc.GetMulti([]string{binIncr.Key, "binary_missing"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(items).To(HaveLen(1))
+		Expect(items[binIncr.Key].Value).To(Equal([]byte("0")))
+
+		By("Touch and GetAndTouch update the expiration")
+		Expect(mc.Touch(binIncr.Key, time.Hour)).To(Succeed())
+		Expect(mc.Touch("binary_missing", time.Hour)).To(MatchError(ErrCacheMiss))
+		res, err = mc.GetsAndTouch(binIncr.Key, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Value).To(Equal([]byte("0")))
+		Expect(res.CAS).ToNot(BeZero())
+		items, err = mc.GetAndTouchMulti([]string{binIncr.Key, "binary_missing"}, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(items).To(HaveLen(1))
+		Expect(items[binIncr.Key].CAS).To(BeZero())
+
+		By("Meta commands are not supported")
+		_, err = mc.MetaGet(binIncr.Key)
+		Expect(err).To(MatchError(ErrNotSupported))
+	})
+
+	It("Connections are authenticated with SASL PLAIN", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer l.Close()
+
+		// The server accepts user:secret and reports a miss
+		// for every other command of an authenticated connection.
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+
+				go func() {
+					defer conn.Close()
+					r := bufio.NewReader(conn)
+					authed := false
+
+					for {
+						req, err := readRequest(r)
+						if err != nil {
+							return
+						}
+
+						status := uint16(0x20)
+						switch {
+						case binaryOpcode(req.hdr[1]) == opSASLAuth:
+							if string(req.body) == "PLAIN\x00user\x00secret" {
+								authed = true
+								status = 0
+							}
+						case authed:
+							status = 0x01
+						}
+
+						res := make([]byte, binaryHeaderLen)
+						res[0] = binaryResMagic
+						res[1] = req.hdr[1]
+						binary.BigEndian.PutUint16(res[6:8], status)
+						copy(res[12:16], req.hdr[12:16])
+						conn.Write(res)
+					}
+				}()
+			}
+		}()
+
+		client := New([]string{l.Addr().String()}, 1, WithProtocol(BinaryProtocol), WithSASL("user", "secret"))
+		Expect(client).ToNot(BeNil())
+		defer client.Close()
+
+		_, err = client.Get("binary_sasl")
+		Expect(err).To(MatchError(ErrCacheMiss))
+
+		By("Rejected credentials fail the connection")
+		wrong := New([]string{l.Addr().String()}, 1, WithProtocol(BinaryProtocol), WithSASL("user", "wrong"))
+		Expect(wrong).ToNot(BeNil())
+		defer wrong.Close()
+
+		_, err = wrong.Get("binary_sasl")
+		Expect(err).To(MatchError(ErrAuthFailed))
+
+		By("The text protocol does not support SASL")
+		text := New([]string{l.Addr().String()}, 1, WithSASL("user", "secret"))
+		Expect(text).ToNot(BeNil())
+		defer text.Close()
+
+		_, err = text.Get("binary_sasl")
+		Expect(err).To(MatchError(ErrNotSupported))
+	})
+})
+
+type binaryRequest struct {
+	hdr  [binaryHeaderLen]byte
+	body []byte
+}
+
+// readRequest reads a request of the binary protocol, the body
+// holds the extras, the key and the value.
+func readRequest(r *bufio.Reader) (*binaryRequest, error) {
+	req := &binaryRequest{}
+	if _, err := io.ReadFull(r, req.hdr[:]); err != nil {
+		return nil, err
+	}
+
+	req.body = make([]byte, binary.BigEndian.Uint32(req.hdr[8:12]))
+	if _, err := io.ReadFull(r, req.body); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
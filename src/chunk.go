@@ -0,0 +1,216 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// FlagChunked is the bit of Item.Flags which marks the manifests of chunked
+// values. It is reserved when chunking is enabled, see WithChunking.
+const FlagChunked int32 = 1 << 29
+
+const (
+	defaultItemSizeLimit = 1 << 20
+	// chunkHeadroom leaves room for the item header and the key
+	// within the item size limit of the server.
+	chunkHeadroom = 1024
+)
+
+// manifest describes where the chunks of a value are stored.
+// Every write uses a new generation, so the chunks of concurrent
+// writers never mix and the manifest is replaced atomically.
+type manifest struct {
+	gen    string
+	chunks int
+	size   int
+}
+
+func (m manifest) String() string {
+	return fmt.Sprintf("%s %d %d", m.gen, m.chunks, m.size)
+}
+
+func (m manifest) chunkKeys() []string {
+	keys := make([]string, m.chunks)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("mcchunk:%s:%d", m.gen, i)
+	}
+
+	return keys
+}
+
+func parseManifest(value []byte) (manifest, error) {
+	var m manifest
+
+	_, err := fmt.Sscanf(string(value), "%s %d %d", &m.gen, &m.chunks, &m.size)
+	if err != nil || m.chunks <= 0 || m.size < 0 {
+		return m, malformedResponse("invalid chunk manifest " + string(value))
+	}
+
+	return m, nil
+}
+
+// storeChunks splits the value of the item into chunks when it does not
+// fit the item size limit. The chunks are stored first and the manifest
+// is stored under the key with the verb last, so a CompareAndSwap or Add
+// of a chunked value succeeds or fails as a whole. The key is the server
+// key of the item. It reports whether the item was chunked.
+func (c *Client) storeChunks(ctx context.Context, verb string, key string, item *Item) (bool, error) {
+	if c.chunkSize == 0 {
+		return false, nil
+	}
+
+	if item.Flags&FlagChunked != 0 {
+		return false, &Error{Kind: ErrClientError, Verb: verb, Msg: "the flags use the bit reserved for chunking"}
+	}
+
+	if len(item.Value) <= c.chunkSize {
+		return false, nil
+	}
+
+	gen := make([]byte, 16)
+	if _, err := rand.Read(gen); err != nil {
+		return true, err
+	}
+
+	m := manifest{
+		gen:    hex.EncodeToString(gen),
+		chunks: (len(item.Value) + c.chunkSize - 1) / c.chunkSize,
+		size:   len(item.Value),
+	}
+
+	keys := m.chunkKeys()
+	chunks := make([]*Item, len(keys))
+	for i, key := range keys {
+		end := min((i+1)*c.chunkSize, len(item.Value))
+		chunks[i] = &Item{Key: key, Value: item.Value[i*c.chunkSize : end], Expiration: item.Expiration}
+	}
+
+	// The chunks of a failed write are never referenced, but they would
+	// take the memory until they expire or are evicted.
+	cleanup := func() {
+		c.deleteMulti(context.WithoutCancel(ctx), keys)
+	}
+
+	errs := c.storeBatch(ctx, chunks)
+	for _, key := range keys {
+		if err := errs[key]; err != nil {
+			cleanup()
+			return true, err
+		}
+	}
+
+	stored := *item
+	stored.Key = key
+	stored.Value = []byte(m.String())
+	stored.Flags |= FlagChunked
+
+	cn, err := c.createReadWriter(ctx, key)
+	if err != nil {
+		cleanup()
+		return true, err
+	}
+
+	if err := c.storageFn(verb, cn, &stored); err != nil {
+		cleanup()
+		return true, err
+	}
+
+	return true, nil
+}
+
+// unpack reassembles chunked values and decompresses the values
+// of a retrieved item. A missing chunk is reported as ErrCacheMiss.
+func (c *Client) unpack(ctx context.Context, verb string, item *Item, ttl time.Duration) (*Item, error) {
+	if c.chunkSize > 0 && item.Flags&FlagChunked != 0 {
+		if err := c.joinChunks(ctx, verb, item, ttl); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.decompress(item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func (c *Client) joinChunks(ctx context.Context, verb string, item *Item, ttl time.Duration) error {
+	m, err := parseManifest(item.Value)
+	if err != nil {
+		return err
+	}
+
+	// The chunks are touched along with the manifest.
+	chunkVerb := "get"
+	if verb == "gat" || verb == "gats" {
+		chunkVerb = "gat"
+	}
+
+	keys := m.chunkKeys()
+	chunks, err := c.getMulti(ctx, chunkVerb, keys, ttl)
+	if err != nil {
+		return err
+	}
+
+	value := make([]byte, 0, m.size)
+	for _, key := range keys {
+		chunk, ok := chunks[key]
+		if !ok {
+			return ErrCacheMiss
+		}
+
+		value = append(value, chunk.Value...)
+	}
+
+	if len(value) != m.size {
+		return malformedResponse(fmt.Sprintf("chunked value has %d bytes instead of %d", len(value), m.size))
+	}
+
+	item.Value = value
+	item.Flags &^= FlagChunked
+
+	return nil
+}
+
+// unpackMulti is like unpack for the items of GetMulti,
+// the items with a missing chunk are removed.
+func (c *Client) unpackMulti(ctx context.Context, verb string, items map[string]*Item, ttl time.Duration) error {
+	for key, it := range items {
+		_, err := c.unpack(ctx, verb, it, ttl)
+
+		switch {
+		case errors.Is(err, ErrCacheMiss):
+			delete(items, key)
+		case err != nil:
+			return err
+		}
+	}
+
+	return nil
+}
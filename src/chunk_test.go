@@ -0,0 +1,147 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache Chunking Tests", Label("Chunking"), func() {
+	var mc, raw *Client
+	var large []byte
+
+	BeforeEach(func() {
+		mc = New([]string{defaultAddr, secondAddr}, 2, WithChunking(0))
+		Expect(mc).ToNot(BeNil())
+		raw = New([]string{defaultAddr, secondAddr}, 1)
+		Expect(raw).ToNot(BeNil())
+
+		large = make([]byte, 3<<20+100)
+		_, err := rand.Read(large)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		mc.Close()
+		raw.Close()
+	})
+
+	It("Values above the item size limit are split into chunks", func() {
+		By("Without chunking the server rejects the value")
+		Expect(raw.Set(&Item{Key: "chunk_large", Value: large})).To(MatchError(ErrServerError))
+
+		Expect(mc.Set(&Item{Key: "chunk_large", Value: large, Flags: 5, Expiration: time.Minute})).To(Succeed())
+
+		By("The item holds the manifest of the chunks")
+		it, err := raw.Get("chunk_large")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Flags).To(Equal(5 | FlagChunked))
+		m, err := parseManifest(it.Value)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.chunks).To(Equal(4))
+		Expect(m.size).To(Equal(len(large)))
+
+		By("The value is reassembled by the Get commands")
+		it, err = mc.Get("chunk_large")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal(large))
+		Expect(it.Flags).To(Equal(int32(5)))
+
+		items, err := mc.GetAndTouchMulti([]string{"chunk_large", "chunk_missing"}, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(items).To(HaveLen(1))
+		Expect(items["chunk_large"].Value).To(Equal(large))
+
+		By("Small values are stored as they are")
+		Expect(mc.Set(&Item{Key: "chunk_small", Value: []byte("small")})).To(Succeed())
+		it, err = raw.Get("chunk_small")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("small")))
+
+		By("A missing chunk is a cache miss")
+		Expect(raw.Delete(m.chunkKeys()[2])).To(Succeed())
+		_, err = mc.Get("chunk_large")
+		Expect(err).To(MatchError(ErrCacheMiss))
+
+		items, err = mc.GetMulti([]string{"chunk_large", "chunk_small"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(items).To(HaveLen(1))
+		Expect(items).To(HaveKey("chunk_small"))
+	})
+
+	It("Chunked values are replaced with CAS safety", func() {
+		Expect(mc.Set(&Item{Key: "chunk_cas", Value: large})).To(Succeed())
+
+		it, err := mc.Gets("chunk_cas")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.CAS).ToNot(BeZero())
+
+		first := *it
+		first.Value = bytes.Repeat([]byte("a"), 2<<20)
+		Expect(mc.CompareAndSwap(&first)).To(Succeed())
+
+		By("A stale CAS value fails without replacing the value")
+		second := *it
+		second.Value = bytes.Repeat([]byte("b"), 2<<20)
+		Expect(mc.CompareAndSwap(&second)).To(MatchError(ErrExists))
+
+		res, err := mc.Get("chunk_cas")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Value).To(Equal(first.Value))
+
+		By("Add fails on an existing key")
+		Expect(mc.Add(&Item{Key: "chunk_cas", Value: large})).To(MatchError(ErrNotStored))
+	})
+
+	It("Chunking works with compression and SetMulti", func() {
+		cmc := New([]string{defaultAddr, secondAddr}, 1, WithProtocol(BinaryProtocol), WithChunking(64<<10),
+			WithCompression(NewGzipCompressor(gzip.DefaultCompression), 1024))
+		Expect(cmc).ToNot(BeNil())
+		defer cmc.Close()
+
+		text := []byte(hex.EncodeToString(large[:512<<10]))
+		errs := cmc.SetMulti([]*Item{
+			{Key: "chunk_multi_1", Value: large},
+			{Key: "chunk_multi_2", Value: text},
+			{Key: "chunk_multi_3", Value: []byte("small")},
+		})
+		Expect(errs).To(BeNil())
+
+		it, err := raw.Get("chunk_multi_2")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Flags).To(Equal(FlagCompressed | FlagChunked))
+
+		items, err := cmc.GetMulti([]string{"chunk_multi_1", "chunk_multi_2", "chunk_multi_3"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(items["chunk_multi_1"].Value).To(Equal(large))
+		Expect(items["chunk_multi_2"].Value).To(Equal(text))
+		Expect(items["chunk_multi_3"].Value).To(Equal([]byte("small")))
+	})
+})
@@ -0,0 +1,241 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// The codec of an object is recorded in the bits 16-23 of Item.Flags.
+const (
+	codecShift = 16
+	// FlagCodecMask covers the bits of Item.Flags which hold the codec id.
+	FlagCodecMask int32 = 0xff << codecShift
+)
+
+// Ids of the built-in codecs. The ids below 16 are reserved for them,
+// zero marks the items which were not stored with a codec.
+const (
+	CodecJSON   uint8 = 1
+	CodecGob    uint8 = 2
+	CodecBytes  uint8 = 3
+	CodecString uint8 = 4
+)
+
+// Codec encodes the objects stored by SetObject and decodes
+// the ones read by GetObject. It has to be concurrent-safe.
+type Codec interface {
+	// ID is recorded in the flags of the item, so readers
+	// pick the same codec. It has to be unique and non-zero.
+	ID() uint8
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec encodes the objects with encoding/json.
+// It is the default codec of the client.
+type JSONCodec struct{}
+
+func (JSONCodec) ID() uint8 {
+	return CodecJSON
+}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec encodes the objects with encoding/gob.
+type GobCodec struct{}
+
+func (GobCodec) ID() uint8 {
+	return CodecGob
+}
+
+func (GobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// BytesCodec stores a []byte as it is.
+// It is used by SetObject for []byte values.
+type BytesCodec struct{}
+
+func (BytesCodec) ID() uint8 {
+	return CodecBytes
+}
+
+func (BytesCodec) Marshal(v any) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T as bytes", v)
+	}
+
+	return b, nil
+}
+
+func (BytesCodec) Unmarshal(data []byte, v any) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal bytes into %T", v)
+	}
+	*b = data
+
+	return nil
+}
+
+// StringCodec stores a string as it is.
+// It is used by SetObject for string values.
+type StringCodec struct{}
+
+func (StringCodec) ID() uint8 {
+	return CodecString
+}
+
+func (StringCodec) Marshal(v any) ([]byte, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T as a string", v)
+	}
+
+	return []byte(s), nil
+}
+
+func (StringCodec) Unmarshal(data []byte, v any) error {
+	s, ok := v.(*string)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal a string into %T", v)
+	}
+	*s = string(data)
+
+	return nil
+}
+
+var builtinCodecs = map[uint8]Codec{
+	CodecJSON:   JSONCodec{},
+	CodecGob:    GobCodec{},
+	CodecBytes:  BytesCodec{},
+	CodecString: StringCodec{},
+}
+
+// SetObject encodes v and stores it under the key.
+// []byte and string values are stored as they are, other values
+// are encoded with the codec of the client, see WithCodec.
+func SetObject[T any](c *Client, key string, v T, expiration time.Duration) error {
+	return setObject(context.Background(), c, key, v, expiration)
+}
+
+// SetObjectContext is like SetObject but honours the deadline and cancellation of ctx.
+func SetObjectContext[T any](ctx context.Context, c *Client, key string, v T, expiration time.Duration) error {
+	return setObject(ctx, c, key, v, expiration)
+}
+
+func setObject[T any](ctx context.Context, c *Client, key string, v T, expiration time.Duration) error {
+	var codec Codec
+
+	switch any(v).(type) {
+	case []byte:
+		codec = BytesCodec{}
+	case string:
+		codec = StringCodec{}
+	default:
+		codec = c.codec
+	}
+
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+
+	if codec.ID() == 0 {
+		return &Error{Kind: ErrCodec, Verb: "set", Msg: "codec id 0 is reserved"}
+	}
+
+	value, err := codec.Marshal(v)
+	if err != nil {
+		return &Error{Kind: ErrCodec, Verb: "set", Msg: err.Error()}
+	}
+
+	return c.set(ctx, &Item{
+		Key:        key,
+		Value:      value,
+		Expiration: expiration,
+		Flags:      int32(codec.ID()) << codecShift,
+	})
+}
+
+// GetObject reads the item of the key and decodes it with the codec
+// recorded in its flags. The codec has to be built-in or registered
+// with WithCodec.
+func GetObject[T any](c *Client, key string) (T, error) {
+	return getObject[T](context.Background(), c, key)
+}
+
+// GetObjectContext is like GetObject but honours the deadline and cancellation of ctx.
+func GetObjectContext[T any](ctx context.Context, c *Client, key string) (T, error) {
+	return getObject[T](ctx, c, key)
+}
+
+func getObject[T any](ctx context.Context, c *Client, key string) (T, error) {
+	var v T
+
+	it, err := c.get(ctx, key)
+	if err != nil {
+		return v, err
+	}
+
+	id := uint8((it.Flags & FlagCodecMask) >> codecShift)
+	if id == 0 {
+		return v, &Error{Kind: ErrCodec, Verb: "get", Msg: "the item was not stored with a codec"}
+	}
+
+	codec, ok := c.codecs[id]
+	if !ok {
+		codec, ok = builtinCodecs[id]
+	}
+
+	if !ok {
+		return v, &Error{Kind: ErrCodec, Verb: "get", Msg: fmt.Sprintf("unknown codec id %d", id)}
+	}
+
+	if err := codec.Unmarshal(it.Value, &v); err != nil {
+		return v, &Error{Kind: ErrCodec, Verb: "get", Msg: err.Error()}
+	}
+
+	return v, nil
+}
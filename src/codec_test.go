@@ -0,0 +1,138 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type codecUser struct {
+	Name  string
+	Age   int
+	Roles []string
+}
+
+// upperCodec stores strings in upper case.
+type upperCodec struct{}
+
+func (upperCodec) ID() uint8 {
+	return 200
+}
+
+func (upperCodec) Marshal(v any) ([]byte, error) {
+	return []byte(strings.ToUpper(v.(codecUser).Name)), nil
+}
+
+func (upperCodec) Unmarshal(data []byte, v any) error {
+	v.(*codecUser).Name = string(data)
+	return nil
+}
+
+var _ = Describe("Memcache Codec Tests", Label("Codec"), func() {
+	user := codecUser{Name: "daniel", Age: 30, Roles: []string{"admin"}}
+
+	It("Objects are stored with the codec recorded in the flags", func() {
+		mc := New([]string{defaultAddr}, 1)
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		By("Structs are encoded with JSON by default")
+		Expect(SetObject(mc, "codec_json", user, time.Minute)).To(Succeed())
+		it, err := mc.Get("codec_json")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Flags).To(Equal(int32(CodecJSON) << 16))
+		Expect(string(it.Value)).To(HavePrefix(`{"Name":"daniel"`))
+
+		res, err := GetObject[codecUser](mc, "codec_json")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(Equal(user))
+
+		By("Bytes and strings are stored as they are")
+		Expect(SetObject(mc, "codec_bytes", []byte("raw"), time.Minute)).To(Succeed())
+		Expect(SetObject(mc, "codec_string", "text", time.Minute)).To(Succeed())
+
+		b, err := GetObject[[]byte](mc, "codec_bytes")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b).To(Equal([]byte("raw")))
+
+		s, err := GetObject[string](mc, "codec_string")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s).To(Equal("text"))
+
+		By("Decoding into a mismatching type fails")
+		_, err = GetObject[string](mc, "codec_bytes")
+		Expect(err).To(MatchError(ErrCodec))
+
+		By("Items stored without a codec cannot be decoded")
+		Expect(mc.Set(&Item{Key: "codec_plain", Value: []byte("plain")})).To(Succeed())
+		_, err = GetObject[string](mc, "codec_plain")
+		Expect(err).To(MatchError(ErrCodec))
+
+		_, err = GetObject[string](mc, "codec_missing")
+		Expect(err).To(MatchError(ErrCacheMiss))
+	})
+
+	It("The reader picks the codec of the writer", func() {
+		gobClient := New([]string{defaultAddr}, 1, WithCodec(GobCodec{}))
+		Expect(gobClient).ToNot(BeNil())
+		defer gobClient.Close()
+
+		customClient := New([]string{defaultAddr}, 1, WithCodec(upperCodec{}))
+		Expect(customClient).ToNot(BeNil())
+		defer customClient.Close()
+
+		reader := New([]string{defaultAddr}, 1, WithCodec(JSONCodec{}, upperCodec{}), WithCompression(NewGzipCompressor(1), 0))
+		Expect(reader).ToNot(BeNil())
+		defer reader.Close()
+
+		Expect(SetObject(gobClient, "codec_gob", user, time.Minute)).To(Succeed())
+		Expect(SetObject(customClient, "codec_custom", user, time.Minute)).To(Succeed())
+
+		res, err := GetObject[codecUser](reader, "codec_gob")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(Equal(user))
+
+		res, err = GetObject[codecUser](reader, "codec_custom")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Name).To(Equal("DANIEL"))
+
+		By("A codec which is not registered is reported")
+		_, err = GetObject[codecUser](gobClient, "codec_custom")
+		Expect(err).To(MatchError(ContainSubstring("unknown codec id 200")))
+
+		By("Objects are compressed like other values")
+		large := codecUser{Name: strings.Repeat("daniel", 100)}
+		Expect(SetObject(reader, "codec_compressed", large, time.Minute)).To(Succeed())
+		it, err := gobClient.Get("codec_compressed")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Flags).To(Equal(int32(CodecJSON)<<16 | FlagCompressed))
+
+		res, err = GetObject[codecUser](reader, "codec_compressed")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(Equal(large))
+	})
+})
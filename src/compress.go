@@ -0,0 +1,163 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"sync"
+)
+
+// FlagCompressed is the bit of Item.Flags which marks compressed values.
+// It is reserved when compression is enabled, see WithCompression.
+const FlagCompressed int32 = 1 << 30
+
+// Compressor compresses the values of the items.
+// It has to be concurrent-safe.
+type Compressor interface {
+	Compress(value []byte) ([]byte, error)
+	Decompress(value []byte) ([]byte, error)
+}
+
+// NewGzipCompressor returns a Compressor using gzip with the given level,
+// e.g. gzip.DefaultCompression.
+func NewGzipCompressor(level int) Compressor {
+	return &flateCompressor{
+		newWriter: func(w io.Writer) (resetWriter, error) {
+			return gzip.NewWriterLevel(w, level)
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	}
+}
+
+// NewZlibCompressor returns a Compressor using zlib with the given level,
+// e.g. zlib.DefaultCompression.
+func NewZlibCompressor(level int) Compressor {
+	return &flateCompressor{
+		newWriter: func(w io.Writer) (resetWriter, error) {
+			return zlib.NewWriterLevel(w, level)
+		},
+		newReader: zlib.NewReader,
+	}
+}
+
+type resetWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// flateCompressor reuses the writers, which are expensive to allocate.
+type flateCompressor struct {
+	newWriter func(w io.Writer) (resetWriter, error)
+	newReader func(r io.Reader) (io.ReadCloser, error)
+	writers   sync.Pool
+}
+
+func (f *flateCompressor) Compress(value []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w, ok := f.writers.Get().(resetWriter)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		var err error
+		if w, err = f.newWriter(&buf); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := w.Write(value); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	f.writers.Put(w)
+
+	return buf.Bytes(), nil
+}
+
+func (f *flateCompressor) Decompress(value []byte) ([]byte, error) {
+	r, err := f.newReader(bytes.NewReader(value))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// compress returns a copy of the item with the value compressed
+// when compression is enabled and the value is large enough.
+// The value is stored as it is if compressing does not make it smaller.
+func (c *Client) compress(verb string, item *Item) (*Item, error) {
+	if c.compressor == nil {
+		return item, nil
+	}
+
+	if item.Flags&FlagCompressed != 0 {
+		return nil, &Error{Kind: ErrCompression, Verb: verb, Msg: "the flags use the bit reserved for compression"}
+	}
+
+	if len(item.Value) < c.compressMin {
+		return item, nil
+	}
+
+	value, err := c.compressor.Compress(item.Value)
+	if err != nil {
+		return nil, &Error{Kind: ErrCompression, Verb: verb, Msg: err.Error()}
+	}
+
+	if len(value) >= len(item.Value) {
+		return item, nil
+	}
+
+	compressed := *item
+	compressed.Value = value
+	compressed.Flags |= FlagCompressed
+
+	return &compressed, nil
+}
+
+// decompress restores the value of a compressed item in place.
+// Without compression enabled the items are returned as they are stored.
+func (c *Client) decompress(item *Item) error {
+	if c.compressor == nil || item.Flags&FlagCompressed == 0 {
+		return nil
+	}
+
+	value, err := c.compressor.Decompress(item.Value)
+	if err != nil {
+		return &Error{Kind: ErrCompression, Msg: err.Error()}
+	}
+
+	item.Value = value
+	item.Flags &^= FlagCompressed
+
+	return nil
+}
@@ -0,0 +1,154 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// reverseCompressor is not a compressor at all,
+// it shows that any codec can be plugged in.
+type reverseCompressor struct{}
+
+func (reverseCompressor) Compress(value []byte) ([]byte, error) {
+	res := make([]byte, 0, len(value)/2)
+	for i := len(value) - 1; i >= 0; i -= 2 {
+		res = append(res, value[i])
+	}
+
+	return res, nil
+}
+
+func (reverseCompressor) Decompress(value []byte) ([]byte, error) {
+	return nil, errors.New("cannot restore the value")
+}
+
+var _ = Describe("Memcache Compression Tests", Label("Compression"), func() {
+	blob := []byte(strings.Repeat(`{"name":"memcache-go","tags":["cache","go"]},`, 200))
+
+	for _, comp := range []struct {
+		name string
+		c    Compressor
+	}{
+		{"gzip", NewGzipCompressor(gzip.BestSpeed)},
+		{"zlib", NewZlibCompressor(zlib.DefaultCompression)},
+	} {
+		comp := comp
+
+		It(fmt.Sprintf("Values are compressed with %s above the threshold", comp.name), func() {
+			mc := New([]string{defaultAddr}, 1, WithCompression(comp.c, 1024))
+			Expect(mc).ToNot(BeNil())
+			defer mc.Close()
+
+			raw := New([]string{defaultAddr}, 1)
+			Expect(raw).ToNot(BeNil())
+			defer raw.Close()
+
+			key := "compress_" + comp.name
+			Expect(mc.Set(&Item{Key: key, Value: blob, Flags: 7, Expiration: time.Minute})).To(Succeed())
+			Expect(mc.Set(&Item{Key: key + "_small", Value: []byte("small"), Flags: 7, Expiration: time.Minute})).To(Succeed())
+
+			By("The stored value is smaller and marked with the flag")
+			it, err := raw.Get(key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(it.Value)).To(BeNumerically("<", len(blob)/10))
+			Expect(it.Flags).To(Equal(7 | FlagCompressed))
+
+			it, err = raw.Get(key + "_small")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(it.Value).To(Equal([]byte("small")))
+			Expect(it.Flags).To(Equal(int32(7)))
+
+			By("The value is decompressed by the Get commands")
+			it, err = mc.Get(key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(it.Value).To(Equal(blob))
+			Expect(it.Flags).To(Equal(int32(7)))
+
+			it, err = mc.GetsAndTouch(key, time.Minute)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(it.Value).To(Equal(blob))
+
+			items, err := mc.GetMulti([]string{key, key + "_small"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(items[key].Value).To(Equal(blob))
+			Expect(items[key+"_small"].Value).To(Equal([]byte("small")))
+
+			By("The value written by CompareAndSwap is compressed")
+			changed := bytes.ToUpper(blob)
+			it.Value = changed
+			Expect(mc.CompareAndSwap(it)).To(Succeed())
+			it, err = mc.Get(key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(it.Value).To(Equal(changed))
+		})
+	}
+
+	It("SetMulti compresses the values and rejects the reserved flag", func() {
+		mc := New([]string{defaultAddr}, 1, WithProtocol(BinaryProtocol), WithCompression(NewGzipCompressor(gzip.DefaultCompression), 0))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		errs := mc.SetMulti([]*Item{
+			{Key: "compress_multi_1", Value: blob},
+			{Key: "compress_multi_2", Value: blob, Flags: FlagCompressed},
+		})
+		Expect(errs).To(HaveLen(1))
+		Expect(errs["compress_multi_2"]).To(MatchError(ErrCompression))
+
+		it, err := mc.Get("compress_multi_1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal(blob))
+
+		Expect(mc.Set(&Item{Key: "compress_multi_2", Value: blob, Flags: FlagCompressed})).To(MatchError(ErrCompression))
+	})
+
+	It("A value which cannot be decompressed fails with ErrCompression", func() {
+		mc := New([]string{defaultAddr}, 1, WithCompression(reverseCompressor{}, 0))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		Expect(mc.Set(&Item{Key: "compress_broken", Value: blob})).To(Succeed())
+
+		it, err := mc.Get("compress_broken")
+		Expect(it).To(BeNil())
+		Expect(err).To(MatchError(ErrCompression))
+
+		var merr *Error
+		Expect(errors.As(err, &merr)).To(BeTrue())
+		Expect(merr.Verb).To(Equal("get"))
+		Expect(merr.Addr).To(Equal(defaultAddr))
+
+		_, err = mc.GetMulti([]string{"compress_broken"})
+		Expect(err).To(MatchError(ErrCompression))
+	})
+})
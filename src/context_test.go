@@ -0,0 +1,113 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"context"
+	"net"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache Context Tests", Label("Context"), func() {
+	var mc *Client
+	var hung net.Listener
+	var hungConns chan net.Conn
+
+	BeforeEach(func() {
+		var err error
+
+		// A server which accepts connections but never replies.
+		hung, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+
+		hungConns = make(chan net.Conn, 16)
+		go func() {
+			for {
+				nc, err := hung.Accept()
+				if err != nil {
+					return
+				}
+				hungConns <- nc
+			}
+		}()
+
+		mc = New([]string{hung.Addr().String()}, 1)
+		Expect(mc).ToNot(BeNil())
+	})
+
+	AfterEach(func() {
+		mc.Close()
+		hung.Close()
+
+		for len(hungConns) > 0 {
+			(<-hungConns).Close()
+		}
+	})
+
+	It("Operations honour the context", func() {
+		By("A cancelled context fails right away")
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := mc.GetContext(ctx, "hello")
+		Expect(err).To(MatchError(context.Canceled))
+
+		By("The context deadline is applied to the connection")
+		ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err = mc.SetContext(ctx, &Item{Key: "hello", Value: []byte("world")})
+		Expect(err).To(MatchError(os.ErrDeadlineExceeded))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+
+		By("Waiting for a free connection is abandoned")
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			mc.Get("hello")
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err = mc.GetContext(ctx, "hello")
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+
+		By("The pending operation fails once the server goes away")
+		for len(hungConns) > 0 {
+			(<-hungConns).Close()
+		}
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("Operations honour the client timeout", func() {
+		mc = New([]string{hung.Addr().String()}, 1, WithTimeout(100*time.Millisecond))
+		Expect(mc).ToNot(BeNil())
+
+		_, err := mc.Incr("counter", 1)
+		Expect(err).To(MatchError(os.ErrDeadlineExceeded))
+	})
+})
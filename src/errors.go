@@ -0,0 +1,107 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"errors"
+	"strings"
+)
+
+func (e *Error) Error() string {
+	var sb strings.Builder
+
+	if e.Verb != "" {
+		sb.WriteString(e.Verb)
+		sb.WriteByte(' ')
+	}
+
+	if e.Addr != "" {
+		sb.WriteString(e.Addr)
+		sb.WriteString(": ")
+	}
+
+	if e.Kind != nil {
+		sb.WriteString(e.Kind.Error())
+	}
+
+	if e.Msg != "" {
+		sb.WriteString(": ")
+		sb.WriteString(e.Msg)
+	}
+
+	return sb.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// wrapError fills the server address and the verb of the errors
+// reported by the server. Network errors are returned as they are.
+func (cn *Connection) wrapError(verb string, err error) error {
+	var e *Error
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &e):
+	case err == ErrCacheMiss, err == ErrNotStored, err == ErrExists,
+		err == ErrError, err == ErrClientError, err == ErrServerError:
+		e = &Error{Kind: err}
+	default:
+		return err
+	}
+
+	if e.Addr == "" {
+		e.Addr = cn.pool.addr.String()
+	}
+
+	if e.Verb == "" {
+		e.Verb = verb
+	}
+
+	return e
+}
+
+// parseErrorLine converts an error line sent by the server to an Error.
+// Anything else is reported as a malformed response.
+func parseErrorLine(line []byte) error {
+	msg := strings.TrimSpace(string(line))
+
+	switch {
+	case msg == "ERROR":
+		return ErrError
+	case strings.HasPrefix(msg, "ERROR"):
+		return &Error{Kind: ErrError, Msg: strings.TrimLeft(msg[5:], ": ")}
+	case strings.HasPrefix(msg, "CLIENT_ERROR"):
+		return &Error{Kind: ErrClientError, Msg: strings.TrimSpace(msg[12:])}
+	case strings.HasPrefix(msg, "SERVER_ERROR"):
+		return &Error{Kind: ErrServerError, Msg: strings.TrimSpace(msg[12:])}
+	}
+
+	return malformedResponse(msg)
+}
+
+func malformedResponse(msg string) error {
+	return &Error{Kind: ErrMalformedResponse, Msg: msg}
+}
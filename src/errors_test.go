@@ -0,0 +1,143 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache Error Tests", Label("Errors"), func() {
+	var (
+		l       net.Listener
+		replies chan string
+	)
+
+	// The server answers every command with the next reply,
+	// the data block of the storage commands is skipped.
+	BeforeEach(func() {
+		var err error
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		replies = make(chan string, 10)
+
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+
+				go func() {
+					defer conn.Close()
+					r := bufio.NewReader(conn)
+
+					for {
+						line, err := r.ReadString('\n')
+						if err != nil {
+							return
+						}
+						if strings.HasPrefix(line, "set ") {
+							r.ReadString('\n')
+						}
+						conn.Write([]byte(<-replies))
+					}
+				}()
+			}
+		}()
+	})
+
+	AfterEach(func() {
+		l.Close()
+	})
+
+	It("Server messages are kept in the error", func() {
+		mc := New([]string{l.Addr().String()}, 1)
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		replies <- "SERVER_ERROR out of memory storing object\r\n"
+		err := mc.Set(&Item{Key: "key", Value: []byte("value")})
+		Expect(err).To(MatchError(ErrServerError))
+
+		var merr *Error
+		Expect(errors.As(err, &merr)).To(BeTrue())
+		Expect(merr.Kind).To(Equal(ErrServerError))
+		Expect(merr.Addr).To(Equal(l.Addr().String()))
+		Expect(merr.Verb).To(Equal("set"))
+		Expect(merr.Msg).To(Equal("out of memory storing object"))
+
+		replies <- "CLIENT_ERROR bad data chunk\r\n"
+		err = mc.Set(&Item{Key: "key", Value: []byte("value")})
+		Expect(err).To(MatchError(ErrClientError))
+		Expect(err.Error()).To(ContainSubstring("bad data chunk"))
+
+		replies <- "NOT_FOUND\r\n"
+		Expect(mc.Delete("key")).To(MatchError(ErrCacheMiss))
+	})
+
+	It("Unexpected responses do not panic", func() {
+		mc := New([]string{l.Addr().String()}, 1)
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		for _, reply := range []string{"WHAT\r\n", "\n", "VALUE key x 5\r\n", "VALUE key 0 9223372036854775807\r\n"} {
+			replies <- reply
+			Expect(mc.Delete("key")).To(MatchError(ErrMalformedResponse))
+
+			replies <- reply
+			Expect(mc.Set(&Item{Key: "key", Value: []byte("value")})).To(MatchError(ErrMalformedResponse))
+
+			replies <- reply
+			_, err := mc.Incr("key", 1)
+			Expect(err).To(MatchError(ErrMalformedResponse))
+
+			replies <- reply
+			_, err = mc.Get("key")
+			Expect(err).To(MatchError(ErrMalformedResponse))
+		}
+
+		for _, reply := range []string{"VA 9223372036854775807\r\n", "VA 2\r\nabcd\r\n"} {
+			replies <- reply
+			_, err := mc.MetaGet("key", MetaReturnValue)
+			Expect(err).To(MatchError(ErrMalformedResponse))
+		}
+	})
+
+	It("An oversized binary response is rejected before it is read", func() {
+		hdr := make([]byte, binaryHeaderLen)
+		hdr[0] = binaryResMagic
+		binary.BigEndian.PutUint32(hdr[8:12], math.MaxUint32)
+
+		_, err := readBinaryPacket(bufio.NewReader(bytes.NewReader(hdr)))
+		Expect(err).To(MatchError(ErrMalformedResponse))
+	})
+})
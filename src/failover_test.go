@@ -0,0 +1,136 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache Failover Tests", Label("Failover"), func() {
+	var deadAddr string
+
+	// keyOn returns a key the client maps to the given server.
+	keyOn := func(mc *Client, addr string) string {
+		for i := 0; ; i++ {
+			key := fmt.Sprintf("failover_%d", i)
+			if picked, err := mc.router.PickServer(key); err == nil && picked.String() == addr {
+				return key
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		deadAddr = l.Addr().String()
+		l.Close()
+	})
+
+	It("Failed servers fail fast once marked down", func() {
+		mc := New([]string{defaultAddr, deadAddr}, 1, WithMarkDown(2, time.Minute))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		key := keyOn(mc, deadAddr)
+		item := &Item{Key: key, Value: []byte("value")}
+
+		Expect(mc.Set(item)).ToNot(Succeed())
+		Expect(mc.Health()[deadAddr].Down).To(BeFalse())
+
+		mc.pools[deadAddr].retryAt = time.Time{}
+		Expect(mc.Set(item)).ToNot(Succeed())
+		Expect(mc.Health()[deadAddr].Down).To(BeTrue())
+
+		mc.pools[deadAddr].retryAt = time.Time{}
+		Expect(mc.Set(item)).To(MatchError(ErrServerDown))
+	})
+
+	It("Keys of a server marked down fail over to the next one", func() {
+		mc := New([]string{defaultAddr, deadAddr}, 1, WithMarkDown(1, time.Minute), WithFailover())
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		key := keyOn(mc, deadAddr)
+		item := &Item{Key: key, Value: []byte("value"), Expiration: time.Minute}
+
+		Expect(mc.Set(item)).ToNot(Succeed())
+		Expect(mc.Health()[deadAddr].Down).To(BeTrue())
+
+		Expect(mc.Set(item)).To(Succeed())
+		it, err := mc.GetMulti([]string{key})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it[key].Value).To(Equal([]byte("value")))
+	})
+
+	It("Servers marked down are probed until they respond", func() {
+		mc := New([]string{deadAddr}, 1, WithMarkDown(1, 50*time.Millisecond))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		_, err := mc.Get("key")
+		Expect(err).To(HaveOccurred())
+		Expect(mc.Health()[deadAddr].Down).To(BeTrue())
+
+		By("The server comes back and answers the version command")
+		l, err := net.Listen("tcp", deadAddr)
+		Expect(err).ToNot(HaveOccurred())
+		defer l.Close()
+
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+
+				go func() {
+					defer conn.Close()
+					r := bufio.NewReader(conn)
+					if line, _ := r.ReadString('\n'); line == "version\r\n" {
+						conn.Write([]byte("VERSION 1.6.21\r\n"))
+					}
+				}()
+			}
+		}()
+
+		Eventually(func() bool {
+			return mc.Health()[deadAddr].Down
+		}).WithTimeout(time.Second).Should(BeFalse())
+		Expect(mc.Health()[deadAddr].Healthy).To(BeTrue())
+	})
+
+	It("The probe period has a minimum", func() {
+		for _, period := range []time.Duration{-time.Second, 0, time.Millisecond} {
+			mc := New([]string{deadAddr}, 1, WithMarkDown(1, period))
+			Expect(mc).ToNot(BeNil())
+			Expect(mc.deadTimeout).To(Equal(minProbePeriod))
+			mc.Close()
+		}
+	})
+})
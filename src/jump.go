@@ -0,0 +1,79 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"hash/fnv"
+	"net"
+)
+
+// JumpHash picks servers with the jump consistent hash of Lamping and Veach.
+// It needs no memory and spreads the keys evenly, but only adding or removing
+// servers at the end of the list keeps the placement of the other keys.
+// It is concurrent-safe.
+type JumpHash struct {
+	ServerList
+}
+
+// PickServer returns the bucket of the key's hash.
+func (j *JumpHash) PickServer(key string) (net.Addr, error) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	if len(j.addrs) == 0 {
+		return nil, ErrNoServers
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(key))
+
+	return j.addrs[jumpHash(h.Sum64(), len(j.addrs))], nil
+}
+
+// PickServers returns the bucket of the key's hash
+// followed by the servers after it in the list.
+func (j *JumpHash) PickServers(key string) ([]net.Addr, error) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	if len(j.addrs) == 0 {
+		return nil, ErrNoServers
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(key))
+
+	return rotateAddrs(j.addrs, jumpHash(h.Sum64(), len(j.addrs))), nil
+}
+
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+
+	return int(b)
+}
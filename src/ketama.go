@@ -0,0 +1,192 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"crypto/md5"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"sync"
+)
+
+// ketamaPointsPerHash is the number of continuum points taken from a single MD5 digest.
+const ketamaPointsPerHash = 4
+
+// ketamaHashesPerServer gives 160 points to every server of the same weight.
+const ketamaHashesPerServer = 40
+
+// Ketama distributes keys over a continuum of points as libketama does.
+// Every server gets 160 points scaled by its weight, so adding or removing
+// a server only remaps the keys that belonged to it. The point of a server
+// is derived from its address as it was given, e.g. "10.0.0.1:11211-0".
+// The placement is compatible with libketama and with spymemcached when
+// the servers are given as IP:port. It is not compatible with libmemcached
+// for the servers on the default port, which it hashes without the port.
+// It is concurrent-safe.
+type Ketama struct {
+	mu      sync.RWMutex
+	weights map[string]int
+	addrs   []net.Addr
+	points  []ketamaPoint
+}
+
+type ketamaPoint struct {
+	hash uint32
+	addr net.Addr
+}
+
+// NewKetama creates a continuum with the given server weights.
+// Servers missing from the weights have a weight of one.
+func NewKetama(weights map[string]int) *Ketama {
+	return &Ketama{weights: weights}
+}
+
+// SetServers rebuilds the continuum for the given servers.
+func (k *Ketama) SetServers(addresses ...string) error {
+	addrs, err := resolveAddrs(addresses)
+	if err != nil {
+		return err
+	}
+
+	totalWeight := 0
+	for _, server := range addresses {
+		totalWeight += k.weight(server)
+	}
+
+	var points []ketamaPoint
+
+	for i, server := range addresses {
+		pct := float64(k.weight(server)) / float64(totalWeight)
+		hashes := int(math.Floor(pct*ketamaHashesPerServer*float64(len(addresses)) + 0.0000000001))
+
+		for h := 0; h < hashes; h++ {
+			digest := md5.Sum([]byte(fmt.Sprintf("%s-%d", server, h)))
+
+			for p := 0; p < ketamaPointsPerHash; p++ {
+				points = append(points, ketamaPoint{
+					hash: ketamaDigestPoint(digest, p),
+					addr: addrs[i],
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].hash < points[j].hash
+	})
+
+	k.mu.Lock()
+	k.addrs = addrs
+	k.points = points
+	k.mu.Unlock()
+
+	return nil
+}
+
+func (k *Ketama) weight(server string) int {
+	if w, ok := k.weights[server]; ok && w > 0 {
+		return w
+	}
+
+	return 1
+}
+
+// PickServer returns the server owning the first point
+// of the continuum following the hash of the key.
+func (k *Ketama) PickServer(key string) (net.Addr, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if len(k.points) == 0 {
+		return nil, ErrNoServers
+	}
+
+	return k.points[k.search(ketamaHash(key))].addr, nil
+}
+
+// PickServers returns the servers in the order their points
+// follow the hash of the key on the continuum.
+func (k *Ketama) PickServers(key string) ([]net.Addr, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if len(k.points) == 0 {
+		return nil, ErrNoServers
+	}
+
+	addrs := make([]net.Addr, 0, len(k.addrs))
+	seen := make(map[net.Addr]bool, len(k.addrs))
+
+	start := k.search(ketamaHash(key))
+	for i := 0; i < len(k.points) && len(addrs) < len(k.addrs); i++ {
+		addr := k.points[(start+i)%len(k.points)].addr
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+
+	return addrs, nil
+}
+
+// search returns the index of the first point not lower than the hash,
+// wrapping around to the beginning of the continuum.
+func (k *Ketama) search(hash uint32) int {
+	i := sort.Search(len(k.points), func(i int) bool {
+		return k.points[i].hash >= hash
+	})
+
+	if i == len(k.points) {
+		return 0
+	}
+
+	return i
+}
+
+// Each calls fn for every server until it returns an error.
+func (k *Ketama) Each(fn func(net.Addr) error) error {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, addr := range k.addrs {
+		if err := fn(addr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func ketamaHash(key string) uint32 {
+	return ketamaDigestPoint(md5.Sum([]byte(key)), 0)
+}
+
+// ketamaDigestPoint reads the n-th little endian 32-bit value of the digest.
+func ketamaDigestPoint(digest [md5.Size]byte, n int) uint32 {
+	return uint32(digest[3+n*4])<<24 |
+		uint32(digest[2+n*4])<<16 |
+		uint32(digest[1+n*4])<<8 |
+		uint32(digest[n*4])
+}
@@ -0,0 +1,137 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache Ketama Tests", Label("Ketama"), func() {
+	servers := []string{"10.0.1.1:11211", "10.0.1.2:11211", "10.0.1.3:11211"}
+
+	placement := func(k *Ketama, keys int) map[string]string {
+		res := make(map[string]string, keys)
+		for i := 0; i < keys; i++ {
+			key := fmt.Sprintf("key_%d", i)
+			addr, err := k.PickServer(key)
+			Expect(err).ToNot(HaveOccurred())
+			res[key] = addr.String()
+		}
+		return res
+	}
+
+	It("Every server gets 160 points", func() {
+		k := NewKetama(nil)
+		Expect(k.SetServers(servers...)).To(Succeed())
+		Expect(k.points).To(HaveLen(160 * len(servers)))
+	})
+
+	It("Keys are placed like libketama places them", func() {
+		// The expected placement was generated by libcouchbase, whose continuum
+		// is the one of libketama, for the servers of a four node cluster.
+		golden := []string{"10.0.0.195:12000", "localhost:12002", "localhost:12004", "localhost:12006"}
+		vectors := []struct {
+			key    string
+			hash   uint32
+			server string
+		}{
+			{"Key_0", 1026020100, "10.0.0.195:12000"},
+			{"Key_1", 3873048688, "localhost:12006"},
+			{"Key_2", 2403924765, "localhost:12006"},
+			{"Key_3", 2008332683, "localhost:12004"},
+			{"Key_4", 1573343827, "localhost:12004"},
+			{"Key_5", 1871385817, "localhost:12002"},
+			{"Key_6", 1628642608, "localhost:12002"},
+			{"Key_7", 664051479, "localhost:12002"},
+			{"Key_8", 3667930227, "localhost:12004"},
+			{"Key_9", 3227600046, "localhost:12006"},
+			{"Key_10", 2719205511, "localhost:12004"},
+			{"Key_11", 1452141943, "10.0.0.195:12000"},
+			{"Key_12", 1470885744, "localhost:12002"},
+			{"Key_13", 2352037791, "10.0.0.195:12000"},
+			{"Key_14", 2373181896, "localhost:12006"},
+			{"Key_15", 1022757918, "localhost:12004"},
+		}
+
+		k := NewKetama(nil)
+		Expect(k.SetServers(golden...)).To(Succeed())
+
+		resolved := make(map[string]string, len(golden))
+		for i, server := range golden {
+			resolved[server] = k.addrs[i].String()
+		}
+
+		for _, v := range vectors {
+			Expect(ketamaHash(v.key)).To(Equal(v.hash))
+
+			addr, err := k.PickServer(v.key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(addr.String()).To(Equal(resolved[v.server]), v.key)
+		}
+	})
+
+	It("Adding a server only remaps the keys it takes over", func() {
+		k := NewKetama(nil)
+		Expect(k.SetServers(servers...)).To(Succeed())
+		before := placement(k, 10000)
+
+		Expect(k.SetServers(append(servers, "10.0.1.4:11211")...)).To(Succeed())
+		after := placement(k, 10000)
+
+		moved := 0
+		for key, addr := range before {
+			if after[key] != addr {
+				Expect(after[key]).To(Equal("10.0.1.4:11211"))
+				moved++
+			}
+		}
+		Expect(moved).To(BeNumerically("~", 2500, 700))
+	})
+
+	It("Servers get keys according to their weight", func() {
+		k := NewKetama(map[string]int{"10.0.1.1:11211": 2})
+		Expect(k.SetServers(servers...)).To(Succeed())
+
+		counts := make(map[string]int)
+		for _, addr := range placement(k, 10000) {
+			counts[addr]++
+		}
+		Expect(counts["10.0.1.1:11211"]).To(BeNumerically("~", 5000, 800))
+		Expect(counts["10.0.1.2:11211"]).To(BeNumerically("~", 2500, 600))
+	})
+
+	It("Memcache Commands with a ketama client", func() {
+		mc := New([]string{defaultAddr}, 1, WithKetama(nil))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		Expect(mc.Set(&Item{Key: "ketama", Value: []byte("value"), Expiration: time.Minute})).To(Succeed())
+		it, err := mc.Get("ketama")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("value")))
+	})
+})
@@ -0,0 +1,78 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+)
+
+// hashMarker precedes the hashed keys. The keys starting with it are
+// hashed as well, so a hashed key never equals a key sent as it is.
+const hashMarker = "sha1:"
+
+// serverKey returns the key sent to the servers, the key prefixed
+// with the namespace of the client. Invalid keys are replaced by
+// their SHA-1 hash with WithKeyHashing instead of being rejected.
+func (c *Client) serverKey(key string) (string, error) {
+	marked := c.hashKeys && strings.HasPrefix(key, hashMarker)
+	if prefixed := c.keyPrefix + key; !marked && c.isKeyValid(prefixed) {
+		return prefixed, nil
+	}
+
+	if c.hashKeys {
+		if hashed := c.hashedKey(key); c.isKeyValid(hashed) {
+			return hashed, nil
+		}
+	}
+
+	return "", ErrMalformedKey
+}
+
+// isKeyValid allows any bytes in the keys with WithBinaryKeys.
+func (c *Client) isKeyValid(key string) bool {
+	if c.binaryKeys {
+		return len(key) > 0 && len(key) <= 250
+	}
+
+	return isKeyValid(key)
+}
+
+func (c *Client) hashedKey(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return c.keyPrefix + hashMarker + hex.EncodeToString(sum[:])
+}
+
+// withKey returns the item stored under the server key,
+// the item of the caller is not modified.
+func withKey(item *Item, key string) *Item {
+	if item.Key == key {
+		return item
+	}
+
+	it := *item
+	it.Key = key
+
+	return &it
+}
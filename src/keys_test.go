@@ -0,0 +1,244 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache Key Tests", Label("Keys"), func() {
+	var raw *Client
+
+	BeforeEach(func() {
+		raw = New([]string{defaultAddr}, 1)
+		Expect(raw).ToNot(BeNil())
+	})
+
+	AfterEach(func() {
+		raw.Close()
+	})
+
+	It("The prefix is applied to every operation", func() {
+		mc := New([]string{defaultAddr}, 1, WithKeyPrefix("ns1:"))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		Expect(mc.Set(&Item{Key: "prefix_1", Value: []byte("one"), Expiration: time.Minute})).To(Succeed())
+		Expect(raw.Set(&Item{Key: "prefix_2", Value: []byte("unprefixed")})).To(Succeed())
+
+		it, err := raw.Get("ns1:prefix_1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("one")))
+
+		By("The items carry the keys of the caller")
+		it, err = mc.Gets("prefix_1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Key).To(Equal("prefix_1"))
+		Expect(mc.CompareAndSwap(it)).To(Succeed())
+
+		_, err = mc.Get("prefix_2")
+		Expect(err).To(MatchError(ErrCacheMiss))
+
+		Expect(mc.SetMulti([]*Item{{Key: "prefix_2", Value: []byte("two")}})).To(BeNil())
+		items, err := mc.GetMulti([]string{"prefix_1", "prefix_2"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(items).To(HaveLen(2))
+		Expect(items["prefix_2"].Key).To(Equal("prefix_2"))
+		Expect(items["prefix_2"].Value).To(Equal([]byte("two")))
+
+		res, err := mc.MetaGet("prefix_1", MetaReturnKey, MetaReturnValue)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Key).To(Equal("prefix_1"))
+
+		By("The other commands use the prefix as well")
+		Expect(mc.Set(&Item{Key: "prefix_counter", Value: []byte("1")})).To(Succeed())
+		val, err := mc.Incr("prefix_counter", 2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(val).To(Equal(uint64(3)))
+
+		Expect(mc.Touch("prefix_1", time.Hour)).To(Succeed())
+		Expect(mc.Delete("prefix_1")).To(Succeed())
+		errs := mc.DeleteMulti([]string{"prefix_2", "prefix_missing"})
+		Expect(errs).To(HaveLen(1))
+		Expect(errs["prefix_missing"]).To(MatchError(ErrCacheMiss))
+
+		_, err = raw.Get("prefix_2")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	for _, proto := range []ProtocolType{TextProtocol, BinaryProtocol} {
+		proto := proto
+
+		It(fmt.Sprintf("Invalid keys are hashed instead of being rejected with protocol %d", proto), func() {
+			url := "https://example.com/search?q=memcache go&page=" + strings.Repeat("1", 300)
+			sum := sha1.Sum([]byte(url))
+
+			plain := New([]string{defaultAddr}, 1, WithProtocol(proto), WithKeyPrefix("ns2:"))
+			Expect(plain).ToNot(BeNil())
+			defer plain.Close()
+			Expect(plain.Set(&Item{Key: url, Value: []byte("page")})).ToNot(Succeed())
+
+			mc := New([]string{defaultAddr}, 1, WithProtocol(proto), WithKeyPrefix("ns2:"), WithKeyHashing())
+			Expect(mc).ToNot(BeNil())
+			defer mc.Close()
+
+			Expect(mc.Set(&Item{Key: url, Value: []byte("page")})).To(Succeed())
+			Expect(mc.Set(&Item{Key: "valid", Value: []byte("valid")})).To(Succeed())
+
+			it, err := raw.Get("ns2:sha1:" + hex.EncodeToString(sum[:]))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(it.Value).To(Equal([]byte("page")))
+
+			_, err = raw.Get("ns2:valid")
+			Expect(err).ToNot(HaveOccurred())
+
+			it, err = mc.Get(url)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(it.Key).To(Equal(url))
+			Expect(it.Value).To(Equal([]byte("page")))
+
+			items, err := mc.GetMulti([]string{url, "valid"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(items).To(HaveKey(url))
+			Expect(items).To(HaveKey("valid"))
+
+			By("A valid key looking like a hashed one is hashed too")
+			lookalike := "sha1:" + hex.EncodeToString(sum[:])
+			Expect(mc.Set(&Item{Key: lookalike, Value: []byte("lookalike")})).To(Succeed())
+
+			it, err = mc.Get(url)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(it.Value).To(Equal([]byte("page")))
+
+			it, err = mc.Get(lookalike)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(it.Value).To(Equal([]byte("lookalike")))
+		})
+	}
+
+	It("Keys are validated byte by byte", func() {
+		Expect(isKeyValid("valid:key_1")).To(BeTrue())
+		Expect(isKeyValid(strings.Repeat("é", 125))).To(BeTrue())
+		Expect(isKeyValid(strings.Repeat("é", 126))).To(BeFalse())
+		Expect(isKeyValid(strings.Repeat("a", 251))).To(BeFalse())
+		Expect(isKeyValid("")).To(BeFalse())
+
+		for _, key := range []string{"a b", "a\rb", "a\nb", "a\tb", "a\x00b", "a\x1bb", "a\x7fb"} {
+			Expect(isKeyValid(key)).To(BeFalse(), "%q", key)
+		}
+
+		By("Malformed keys do not reach the server")
+		mc := New([]string{defaultAddr}, 1)
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		Expect(mc.Set(&Item{Key: "malformed\r\nflush_all", Value: []byte("v")})).To(MatchError(ErrMalformedKey))
+		_, err := mc.Get("a\x00b")
+		Expect(err).To(MatchError(ErrMalformedKey))
+		_, err = mc.GetMulti([]string{"valid", "a\tb"})
+		Expect(err).To(MatchError(ErrMalformedKey))
+		errs := mc.DeleteMulti([]string{"a\tb"})
+		Expect(errs["a\tb"]).To(MatchError(ErrMalformedKey))
+		_, err = mc.MetaGet("a b")
+		Expect(err).To(MatchError(ErrMalformedKey))
+
+		Expect(mc.Set(&Item{Key: "after_malformed", Value: []byte("v")})).To(Succeed())
+		it, err := mc.Get("after_malformed")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("v")))
+	})
+
+	for _, proto := range []ProtocolType{TextProtocol, BinaryProtocol} {
+		proto := proto
+
+		It(fmt.Sprintf("Binary keys can contain any bytes with protocol %d", proto), func() {
+			mc := New([]string{defaultAddr}, 1, WithProtocol(proto), WithBinaryKeys())
+			Expect(mc).ToNot(BeNil())
+			defer mc.Close()
+
+			key := fmt.Sprintf("binary %d\r\n\x00\t", proto)
+			other := key + "other"
+
+			Expect(mc.Set(&Item{Key: key, Value: []byte("one"), Flags: 3, Expiration: time.Minute})).To(Succeed())
+			Expect(mc.Add(&Item{Key: key, Value: []byte("two")})).To(MatchError(ErrNotStored))
+			Expect(mc.Append(&Item{Key: key, Value: []byte("!")})).To(Succeed())
+
+			it, err := mc.Gets(key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(it.Key).To(Equal(key))
+			Expect(it.Value).To(Equal([]byte("one!")))
+			Expect(it.Flags).To(Equal(int32(3)))
+
+			it.Value = []byte("swapped")
+			Expect(mc.CompareAndSwap(it)).To(Succeed())
+			Expect(mc.CompareAndSwap(it)).To(MatchError(ErrExists))
+
+			Expect(mc.SetMulti([]*Item{{Key: other, Value: []byte("10")}})).To(BeNil())
+			val, err := mc.Incr(other, 5)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(val).To(Equal(uint64(15)))
+
+			items, err := mc.GetsAndTouchMulti([]string{key, other, key + "missing"}, time.Hour)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(items).To(HaveLen(2))
+			Expect(items[key].Value).To(Equal([]byte("swapped")))
+			Expect(items[key].CAS).ToNot(BeZero())
+			Expect(items[other].Value).To(Equal([]byte("15")))
+
+			Expect(mc.Touch(key, time.Hour)).To(Succeed())
+			Expect(mc.Touch(key+"missing", time.Hour)).To(MatchError(ErrCacheMiss))
+			Expect(mc.DeleteMulti([]string{other})).To(BeNil())
+			Expect(mc.Delete(key)).To(Succeed())
+			_, err = mc.Get(key)
+			Expect(err).To(MatchError(ErrCacheMiss))
+
+			_, err = mc.Get(strings.Repeat("\x00", 251))
+			Expect(err).To(MatchError(ErrMalformedKey))
+		})
+	}
+
+	It("Meta commands encode the binary keys", func() {
+		mc := New([]string{defaultAddr}, 1, WithBinaryKeys())
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		_, err := mc.MetaSet(&Item{Key: "meta binary\x01", Value: []byte("v")})
+		Expect(err).ToNot(HaveOccurred())
+
+		res, err := mc.MetaGet("meta binary\x01", MetaReturnKey, MetaReturnValue)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Key).To(Equal("meta binary\x01"))
+		Expect(res.Value).To(Equal([]byte("v")))
+
+		it, err := mc.Get("meta binary\x01")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("v")))
+	})
+})
@@ -0,0 +1,252 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultLeasePoll = 50 * time.Millisecond
+
+// errLoaderPanicked is returned to the callers waiting
+// for a loader which panicked.
+var errLoaderPanicked = errors.New("loader panicked")
+
+// flightGroup makes sure only one loader runs for a key at a time.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+// do starts fn unless it is already running for the key and waits
+// for its result until ctx is done. fn runs in its own goroutine,
+// so it is not affected by the caller which started it giving up.
+func (g *flightGroup) do(ctx context.Context, key string, fn func() ([]byte, error)) ([]byte, error) {
+	f, _ := g.start(key, fn, true)
+
+	return f.wait(ctx)
+}
+
+// doIdle is like do, but it returns at once with started set to false
+// when fn is already running for the key.
+func (g *flightGroup) doIdle(ctx context.Context, key string, fn func() ([]byte, error)) (value []byte, started bool, err error) {
+	f, started := g.start(key, fn, false)
+	if !started {
+		return nil, false, nil
+	}
+
+	value, err = f.wait(ctx)
+
+	return value, true, err
+}
+
+// start runs fn for the key unless it is already running. The flight
+// already running is returned when join is set, otherwise it is nil.
+func (g *flightGroup) start(key string, fn func() ([]byte, error), join bool) (*flight, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if f, ok := g.calls[key]; ok {
+		if join {
+			return f, false
+		}
+		return nil, false
+	}
+
+	if g.calls == nil {
+		g.calls = make(map[string]*flight)
+	}
+
+	f := &flight{done: make(chan struct{})}
+	g.calls[key] = f
+
+	go g.run(key, f, fn)
+
+	return f, true
+}
+
+func (f *flight) wait(ctx context.Context) ([]byte, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *flightGroup) run(key string, f *flight, fn func() ([]byte, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			f.value, f.err = nil, fmt.Errorf("%w: %v", errLoaderPanicked, r)
+		}
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+
+		close(f.done)
+	}()
+
+	f.value, f.err = fn()
+}
+
+// GetOrLoad returns the value of the key or, on a cache miss, the value
+// returned by the loader, which is stored with the ttl. Only one goroutine
+// of the client runs the loader for a key while the others wait for its
+// result. With WithLoadLease only one client of the cluster runs it.
+// Every caller waits until its own ctx is done, the load is not cancelled
+// while other callers wait for it. Failing to store the loaded value
+// is not reported, a panic of the loader is returned as an error.
+func (c *Client) GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader func() ([]byte, error)) ([]byte, error) {
+	it, err := c.get(ctx, key)
+	if err == nil {
+		return itemValue(it), nil
+	}
+
+	if !errors.Is(err, ErrCacheMiss) {
+		return nil, err
+	}
+
+	return c.loadOnce(ctx, key, ttl, loader, false)
+}
+
+// loadOnce runs the loader in a single flight, the value is stored
+// with its expiration for GetOrRefresh when xfetch is set.
+func (c *Client) loadOnce(ctx context.Context, key string, ttl time.Duration, loader func() ([]byte, error), xfetch bool) ([]byte, error) {
+	// The load is shared by all the callers, so it must not
+	// be cancelled by the one which happened to start it.
+	shared := context.WithoutCancel(ctx)
+
+	return c.flights.do(ctx, key, func() ([]byte, error) {
+		if c.leaseTTL > 0 {
+			return c.loadWithLease(shared, key, ttl, loader, xfetch)
+		}
+
+		return c.load(shared, key, ttl, loader, xfetch)
+	})
+}
+
+func (c *Client) load(ctx context.Context, key string, ttl time.Duration, loader func() ([]byte, error), xfetch bool) ([]byte, error) {
+	start := time.Now()
+
+	value, err := loader()
+	if err != nil {
+		return nil, err
+	}
+
+	item := &Item{Key: key, Value: value, Expiration: ttl}
+	if xfetch {
+		item.Value = encodeXFetch(value, ttl, time.Since(start))
+		item.Flags = FlagXFetch
+	}
+	c.set(context.WithoutCancel(ctx), item)
+
+	return value, nil
+}
+
+// loadWithLease runs the loader once the lease of the key was added.
+// While another client holds the lease, the key is polled until it is
+// loaded or the lease expires. When the lease cannot be added due to
+// a failure, the loader is run anyway.
+func (c *Client) loadWithLease(ctx context.Context, key string, ttl time.Duration, loader func() ([]byte, error), xfetch bool) ([]byte, error) {
+	lease := leaseKey(key)
+
+	for {
+		// The value could have been loaded since the cache miss.
+		it, err := c.get(ctx, key)
+		if err == nil {
+			return itemValue(it), nil
+		}
+
+		if !errors.Is(err, ErrCacheMiss) {
+			return nil, err
+		}
+
+		err = c.add(ctx, &Item{Key: lease, Value: []byte{}, Expiration: c.leaseTTL})
+		switch {
+		case err == nil:
+			defer c.delete(context.WithoutCancel(ctx), lease)
+			return c.load(ctx, key, ttl, loader, xfetch)
+		case !errors.Is(err, ErrNotStored):
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return c.load(ctx, key, ttl, loader, xfetch)
+		}
+
+		if err := c.waitForLease(ctx, key, lease); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitForLease polls the key until it is loaded or the lease is gone.
+// It gives up when the lease cannot be read or once the lease expired.
+func (c *Client) waitForLease(ctx context.Context, key, lease string) error {
+	ticker := time.NewTicker(c.leasePoll)
+	defer ticker.Stop()
+
+	expired := time.NewTimer(c.leaseTTL)
+	defer expired.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-expired.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if _, err := c.get(ctx, key); err == nil {
+			return nil
+		}
+
+		_, err := c.get(ctx, lease)
+		if errors.Is(err, ErrCacheMiss) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// leaseKey returns the key of the lease which is valid for any key.
+func leaseKey(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return "mclease:" + hex.EncodeToString(sum[:])
+}
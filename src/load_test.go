@@ -0,0 +1,277 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache GetOrLoad Tests", Label("GetOrLoad"), func() {
+	var mc *Client
+
+	BeforeEach(func() {
+		mc = New([]string{defaultAddr}, 4)
+		Expect(mc).ToNot(BeNil())
+	})
+
+	AfterEach(func() {
+		mc.Close()
+	})
+
+	It("Only one goroutine runs the loader", func() {
+		var loads atomic.Int32
+		loader := func() ([]byte, error) {
+			loads.Add(1)
+			time.Sleep(100 * time.Millisecond)
+			return []byte("loaded"), nil
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				value, err := mc.GetOrLoad(context.Background(), "load_single", time.Minute, loader)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(value).To(Equal([]byte("loaded")))
+			}()
+		}
+		wg.Wait()
+
+		Expect(loads.Load()).To(Equal(int32(1)))
+
+		By("The loaded value is cached")
+		it, err := mc.Get("load_single")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("loaded")))
+
+		value, err := mc.GetOrLoad(context.Background(), "load_single", time.Minute, loader)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value).To(Equal([]byte("loaded")))
+		Expect(loads.Load()).To(Equal(int32(1)))
+	})
+
+	It("Loader errors are returned and not cached", func() {
+		errLoad := errors.New("database is down")
+		_, err := mc.GetOrLoad(context.Background(), "load_error", time.Minute, func() ([]byte, error) {
+			return nil, errLoad
+		})
+		Expect(err).To(MatchError(errLoad))
+
+		_, err = mc.Get("load_error")
+		Expect(err).To(MatchError(ErrCacheMiss))
+
+		_, err = mc.GetOrLoad(context.Background(), "load error", time.Minute, func() ([]byte, error) {
+			return []byte("never"), nil
+		})
+		Expect(err).To(MatchError(ErrMalformedKey))
+	})
+
+	It("Waiting callers honour their context", func() {
+		release := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			_, err := mc.GetOrLoad(context.Background(), "load_ctx", time.Minute, func() ([]byte, error) {
+				<-release
+				return []byte("late"), nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+		}()
+		defer close(release)
+
+		Eventually(func() int {
+			mc.flights.mu.Lock()
+			defer mc.flights.mu.Unlock()
+			return len(mc.flights.calls)
+		}).Should(Equal(1))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := mc.GetOrLoad(ctx, "load_ctx", time.Minute, func() ([]byte, error) {
+			return []byte("never"), nil
+		})
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("The load goes on when the caller which started it gives up", func() {
+		client := New([]string{defaultAddr}, 2, WithLoadLease(5*time.Second, 10*time.Millisecond))
+		Expect(client).ToNot(BeNil())
+		defer client.Close()
+
+		// Another client holds the lease, so the load polls for it.
+		lease := leaseKey("load_leader")
+		Expect(mc.Add(&Item{Key: lease, Value: []byte{}, Expiration: 5 * time.Second})).To(Succeed())
+
+		loader := func() ([]byte, error) {
+			return []byte("loaded"), nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		leader := make(chan error, 1)
+		go func() {
+			_, err := client.GetOrLoad(ctx, "load_leader", time.Minute, loader)
+			leader <- err
+		}()
+
+		Eventually(func() int {
+			client.flights.mu.Lock()
+			defer client.flights.mu.Unlock()
+			return len(client.flights.calls)
+		}).Should(Equal(1))
+
+		waiter := make(chan []byte, 1)
+		go func() {
+			defer GinkgoRecover()
+
+			value, err := client.GetOrLoad(context.Background(), "load_leader", time.Minute, loader)
+			Expect(err).ToNot(HaveOccurred())
+			waiter <- value
+		}()
+
+		// Let the waiter join the flight before the leader gives up.
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		Eventually(leader).Should(Receive(MatchError(context.Canceled)))
+
+		Expect(mc.Delete(lease)).To(Succeed())
+		Eventually(waiter).Should(Receive(Equal([]byte("loaded"))))
+	})
+
+	It("A panic of the loader is returned as an error", func() {
+		_, err := mc.GetOrLoad(context.Background(), "load_panic", time.Minute, func() ([]byte, error) {
+			panic("boom")
+		})
+		Expect(err).To(MatchError(errLoaderPanicked))
+		Expect(err.Error()).To(ContainSubstring("boom"))
+	})
+
+	It("Only one client of the cluster runs the loader with a lease", func() {
+		var loads atomic.Int32
+		loader := func() ([]byte, error) {
+			loads.Add(1)
+			time.Sleep(200 * time.Millisecond)
+			return []byte("leased"), nil
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			client := New([]string{defaultAddr}, 1, WithLoadLease(5*time.Second, 10*time.Millisecond))
+			Expect(client).ToNot(BeNil())
+			defer client.Close()
+
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				value, err := client.GetOrLoad(context.Background(), "load_lease", time.Minute, loader)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(value).To(Equal([]byte("leased")))
+			}()
+		}
+		wg.Wait()
+
+		Expect(loads.Load()).To(Equal(int32(1)))
+
+		By("The lease is released after loading")
+		_, err := mc.Get(leaseKey("load_lease"))
+		Expect(err).To(MatchError(ErrCacheMiss))
+	})
+
+	It("An abandoned lease is taken over once it expires", func() {
+		Expect(mc.Add(&Item{Key: leaseKey("load_abandoned"), Value: []byte{}, Expiration: time.Second})).To(Succeed())
+
+		client := New([]string{defaultAddr}, 1, WithLoadLease(time.Second, 50*time.Millisecond))
+		Expect(client).ToNot(BeNil())
+		defer client.Close()
+
+		start := time.Now()
+		value, err := client.GetOrLoad(context.Background(), "load_abandoned", time.Minute, func() ([]byte, error) {
+			return []byte("taken over"), nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value).To(Equal([]byte("taken over")))
+		Expect(time.Since(start)).To(BeNumerically(">=", 500*time.Millisecond))
+	})
+
+	It("Waiting for a lease stops when the lease cannot be read", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer l.Close()
+
+		// The server reports a miss and a held lease,
+		// then it fails every command.
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+
+			failing := false
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+
+				switch {
+				case failing:
+					conn.Write([]byte("SERVER_ERROR out of memory\r\n"))
+				case strings.HasPrefix(line, "add"):
+					r.ReadString('\n')
+					conn.Write([]byte("NOT_STORED\r\n"))
+					failing = true
+				default:
+					conn.Write([]byte("END\r\n"))
+				}
+			}
+		}()
+
+		client := New([]string{l.Addr().String()}, 1, WithLoadLease(time.Minute, 10*time.Millisecond))
+		Expect(client).ToNot(BeNil())
+		defer client.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		_, err = client.GetOrLoad(ctx, "load_lease_failed", time.Minute, func() ([]byte, error) {
+			return []byte("value"), nil
+		})
+		Expect(err).To(MatchError(ErrServerError))
+	})
+})
@@ -0,0 +1,238 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// lockRetry is how often Acquire tries to take a held lock.
+const lockRetry = 100 * time.Millisecond
+
+// Lock is a lock shared by all the clients of the servers, e.g. to run
+// a cron job only once. It is stored under its key with a random token
+// of the owner, so only the owner can refresh and release it. The lock
+// expires after its ttl unless it is refreshed, so the lock of an owner
+// which crashed is released eventually. A Lock can be used by several
+// goroutines, e.g. one refreshing it while another does the work.
+type Lock struct {
+	c   *Client
+	key string
+	ttl time.Duration
+
+	mu    sync.Mutex
+	token []byte
+}
+
+// NewLock returns the lock stored under the key. The ttl is at least
+// a second as the servers expire items with a granularity of a second.
+func (c *Client) NewLock(key string, ttl time.Duration) *Lock {
+	return &Lock{c: c, key: key, ttl: max(ttl, time.Second)}
+}
+
+// TryAcquire takes the lock, it returns ErrLocked when it is already held.
+func (l *Lock) TryAcquire() error {
+	return l.tryAcquire(context.Background())
+}
+
+// TryAcquireContext is like TryAcquire but honours the deadline and cancellation of ctx.
+func (l *Lock) TryAcquireContext(ctx context.Context) error {
+	return l.tryAcquire(ctx)
+}
+
+func (l *Lock) tryAcquire(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	token = []byte(hex.EncodeToString(token))
+
+	err := l.c.add(ctx, &Item{Key: l.key, Value: token, Expiration: l.ttl})
+	if errors.Is(err, ErrNotStored) {
+		return ErrLocked
+	}
+
+	if err != nil {
+		return err
+	}
+	l.token = token
+
+	return nil
+}
+
+// Acquire takes the lock, waiting until it is released or expires.
+func (l *Lock) Acquire() error {
+	return l.acquire(context.Background())
+}
+
+// AcquireContext is like Acquire but honours the deadline and cancellation of ctx.
+func (l *Lock) AcquireContext(ctx context.Context) error {
+	return l.acquire(ctx)
+}
+
+func (l *Lock) acquire(ctx context.Context) error {
+	ticker := time.NewTicker(lockRetry)
+	defer ticker.Stop()
+
+	for {
+		err := l.tryAcquire(ctx)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !errors.Is(err, ErrLocked) {
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Refresh extends the lock by its ttl. It returns ErrLockLost when
+// the lock expired or was taken by another owner in the meantime.
+func (l *Lock) Refresh() error {
+	return l.refresh(context.Background())
+}
+
+// RefreshContext is like Refresh but honours the deadline and cancellation of ctx.
+func (l *Lock) RefreshContext(ctx context.Context) error {
+	return l.refresh(ctx)
+}
+
+func (l *Lock) refresh(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	it, err := l.owned(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The swap fails if the lock expired and was taken after it was read.
+	it.Expiration = l.ttl
+	err = l.c.compareAndSwap(ctx, it)
+
+	return l.lost(err)
+}
+
+// Release releases the lock. It returns ErrLockLost when the lock
+// expired or was taken by another owner in the meantime, which is
+// left as it is.
+func (l *Lock) Release() error {
+	return l.release(context.Background())
+}
+
+// ReleaseContext is like Release but honours the deadline and cancellation of ctx.
+func (l *Lock) ReleaseContext(ctx context.Context) error {
+	return l.release(ctx)
+}
+
+func (l *Lock) release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	it, err := l.owned(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = l.c.deleteCAS(ctx, l.key, it.CAS)
+	if err == nil {
+		l.token = nil
+	}
+
+	return l.lost(err)
+}
+
+// owned returns the lock item with its CAS value if it is held by this owner.
+func (l *Lock) owned(ctx context.Context) (*Item, error) {
+	if l.token == nil {
+		return nil, ErrLockLost
+	}
+
+	it, err := l.c.gets(ctx, l.key)
+	if err != nil {
+		return nil, l.lost(err)
+	}
+
+	if !bytes.Equal(it.Value, l.token) {
+		l.token = nil
+		return nil, ErrLockLost
+	}
+
+	return it, nil
+}
+
+// lost reports the lock as lost when it is missing or was modified.
+func (l *Lock) lost(err error) error {
+	if errors.Is(err, ErrCacheMiss) || errors.Is(err, ErrExists) || errors.Is(err, ErrNotStored) {
+		l.token = nil
+		return ErrLockLost
+	}
+
+	return err
+}
+
+// deleteCAS removes the key only if its CAS value was not changed,
+// which needs the meta commands or the binary protocol.
+func (c *Client) deleteCAS(ctx context.Context, key string, cas int64) error {
+	if c.supportsMeta() {
+		_, err := c.metaDelete(ctx, key, []MetaFlag{MetaCompareCAS(cas)})
+		return err
+	}
+
+	bp, ok := c.protocol.(binaryProtocol)
+	if !ok {
+		return ErrNotSupported
+	}
+
+	defer c.near.invalidate(key)
+
+	skey, err := c.serverKey(key)
+	if err != nil {
+		return err
+	}
+
+	cn, err := c.createReadWriter(ctx, skey)
+	if err != nil {
+		return err
+	}
+
+	err = bp.deleteCAS(cn, skey, cas)
+	c.putBackConnection(cn, err)
+
+	return cn.wrapError("delete", err)
+}
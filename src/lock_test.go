@@ -0,0 +1,135 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"context"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache Lock Tests", Label("Lock"), func() {
+	for _, p := range []ProtocolType{TextProtocol, BinaryProtocol} {
+		p := p
+
+		Context("With protocol "+protocolName(p), func() {
+			var mc *Client
+
+			BeforeEach(func() {
+				mc = New([]string{defaultAddr}, 2, WithProtocol(p))
+				Expect(mc).ToNot(BeNil())
+			})
+
+			AfterEach(func() {
+				mc.Close()
+			})
+
+			It("Only one owner holds the lock", func() {
+				key := "lock_owner_" + protocolName(p)
+				l1 := mc.NewLock(key, time.Minute)
+				l2 := mc.NewLock(key, time.Minute)
+
+				Expect(l1.TryAcquire()).To(Succeed())
+				Expect(l2.TryAcquire()).To(MatchError(ErrLocked))
+
+				By("Only the owner can refresh and release the lock")
+				Expect(l2.Refresh()).To(MatchError(ErrLockLost))
+				Expect(l2.Release()).To(MatchError(ErrLockLost))
+				Expect(l1.Refresh()).To(Succeed())
+
+				Expect(l1.Release()).To(Succeed())
+				Expect(l1.Release()).To(MatchError(ErrLockLost))
+
+				Expect(l2.TryAcquire()).To(Succeed())
+				Expect(l2.Release()).To(Succeed())
+			})
+
+			It("An expired lock is not released by its former owner", func() {
+				key := "lock_expired_" + protocolName(p)
+				l1 := mc.NewLock(key, time.Second)
+				l2 := mc.NewLock(key, time.Minute)
+
+				Expect(l1.TryAcquire()).To(Succeed())
+				time.Sleep(1600 * time.Millisecond)
+
+				Expect(l2.TryAcquire()).To(Succeed())
+
+				Expect(l1.Refresh()).To(MatchError(ErrLockLost))
+				Expect(l1.Release()).To(MatchError(ErrLockLost))
+				Expect(mc.NewLock(key, time.Minute).TryAcquire()).To(MatchError(ErrLocked))
+
+				Expect(l2.Release()).To(Succeed())
+			})
+
+			It("Refresh keeps the lock from expiring", func() {
+				key := "lock_refresh_" + protocolName(p)
+				l := mc.NewLock(key, 2*time.Second)
+
+				Expect(l.TryAcquire()).To(Succeed())
+
+				for i := 0; i < 3; i++ {
+					time.Sleep(time.Second)
+					Expect(l.Refresh()).To(Succeed())
+				}
+
+				Expect(mc.NewLock(key, time.Minute).TryAcquire()).To(MatchError(ErrLocked))
+				Expect(l.Release()).To(Succeed())
+			})
+
+			It("Acquire waits for the lock to be released", func() {
+				key := "lock_wait_" + protocolName(p)
+				l1 := mc.NewLock(key, time.Minute)
+				l2 := mc.NewLock(key, time.Minute)
+
+				Expect(l1.Acquire()).To(Succeed())
+
+				ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+				defer cancel()
+				Expect(l2.AcquireContext(ctx)).To(Or(MatchError(context.DeadlineExceeded), MatchError(os.ErrDeadlineExceeded)))
+
+				go func() {
+					defer GinkgoRecover()
+
+					time.Sleep(300 * time.Millisecond)
+					Expect(l1.Release()).To(Succeed())
+				}()
+
+				start := time.Now()
+				Expect(l2.Acquire()).To(Succeed())
+				Expect(time.Since(start)).To(BeNumerically(">=", 250*time.Millisecond))
+				Expect(l2.Release()).To(Succeed())
+			})
+		})
+	}
+})
+
+func protocolName(p ProtocolType) string {
+	if p == BinaryProtocol {
+		return "binary"
+	}
+
+	return "text"
+}
@@ -25,39 +25,105 @@ package memcache
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // New creates a client object.
 // We need a list of addresses and also a number of connections
-// we want to establish with each of the servers. These connections
-// are later used in the connection pool.
-func New(addresses []string, connCount int) *Client {
-	sl := &ServerList{}
-	if err := sl.addServer(addresses...); err != nil {
-		return nil
+// we want to keep with each of the servers. The connections
+// are dialed on demand and reused through the connection pool.
+// The client can be further configured with options.
+func New(addresses []string, connCount int, opts ...Option) *Client {
+	cl := &Client{
+		router:     &ServerList{},
+		protocol:   textProtocol{},
+		maxOpen:    connCount,
+		maxIdle:    connCount,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+		pools:      make(map[string]*connPool),
 	}
 
-	cl := &Client{
-		router:        sl,
-		idleConnCount: connCount,
-		connPool:      make(map[string][]*Connection),
+	for _, opt := range opts {
+		opt(cl)
 	}
 
-	cmp, err := cl.router.InitializeConnectionPool(cl.idleConnCount)
-	if err != nil {
-		return nil
+	if _, ok := cl.protocol.(textProtocol); ok && cl.binaryKeys {
+		cl.protocol = metaProtocol{}
+	}
+
+	if ss, ok := cl.router.(serverSetter); ok && len(addresses) > 0 {
+		if err := ss.SetServers(addresses...); err != nil {
+			return nil
+		}
 	}
 
-	cl.connPool = cmp
+	cl.router.Each(func(addr net.Addr) error {
+		cl.pools[addr.String()] = cl.newPool(addr)
+		return nil
+	})
 
 	return cl
 }
 
+// SetServers replaces the servers of the client.
+// Connection pools are created for the new servers before they start
+// receiving keys and the pools of the removed servers are closed.
+// Operations already using a connection to a removed server finish normally.
+// It fails if the server selector has no SetServers method.
+func (c *Client) SetServers(addresses ...string) error {
+	ss, ok := c.router.(serverSetter)
+	if !ok {
+		return errors.New("server selector does not support setting servers")
+	}
+
+	addrs, err := resolveAddrs(addresses)
+	if err != nil {
+		return err
+	}
+
+	c.updateMu.Lock()
+	defer c.updateMu.Unlock()
+
+	c.mu.Lock()
+	for _, addr := range addrs {
+		if _, ok := c.pools[addr.String()]; !ok {
+			c.pools[addr.String()] = c.newPool(addr)
+		}
+	}
+	c.mu.Unlock()
+
+	err = ss.SetServers(addresses...)
+
+	// Close the pools which are no longer in use, including
+	// the ones just created if the servers could not be set.
+	current := make(map[string]bool)
+	c.router.Each(func(addr net.Addr) error {
+		current[addr.String()] = true
+		return nil
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for addr, p := range c.pools {
+		if !current[addr] {
+			p.close()
+			delete(c.pools, addr)
+		}
+	}
+
+	return err
+}
+
 // Close closes all the connections we established earlier to various servers.
 func (c *Client) Close() error {
 	c.mu.Lock()
@@ -65,174 +131,493 @@ func (c *Client) Close() error {
 
 	var retErr error
 
-	for _, conns := range c.connPool {
-		for _, conn := range conns {
-			if err := conn.conn.Close(); err != nil {
-				retErr = err
-			}
+	for _, p := range c.pools {
+		if err := p.close(); err != nil {
+			retErr = err
 		}
 	}
 
 	return retErr
 }
 
+// Health returns the state of the connections to every server.
+func (c *Client) Health() map[string]ServerHealth {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := make(map[string]ServerHealth, len(c.pools))
+	for addr, p := range c.pools {
+		res[addr] = p.health()
+	}
+
+	return res
+}
+
 // Set is used to set a value to a new key.
 // If a value is already set, the function
 // returns NOT_STORED.
 func (c *Client) Set(item *Item) error {
-	return c.set(item)
+	return c.set(context.Background(), item)
 }
 
-func (c *Client) set(item *Item) error {
-	if ok := isKeyValid(item.Key); !ok {
-		return fmt.Errorf("given key is not valid")
+// SetContext is like Set but honours the deadline and cancellation of ctx.
+func (c *Client) SetContext(ctx context.Context, item *Item) error {
+	return c.set(ctx, item)
+}
+
+func (c *Client) set(ctx context.Context, item *Item) error {
+	defer c.near.invalidate(item.Key)
+
+	key, err := c.serverKey(item.Key)
+	if err != nil {
+		return err
+	}
+
+	item, err = c.compress("set", item)
+	if err != nil {
+		return err
+	}
+
+	if chunked, err := c.storeChunks(ctx, "set", key, item); chunked || err != nil {
+		return err
 	}
 
-	cn, err := c.createReadWriter(item.Key)
+	cn, err := c.createReadWriter(ctx, key)
 	if err != nil {
 		return err
 	}
 
-	return c.storageFn("set", cn, item)
+	return c.storageFn("set", cn, withKey(item, key))
 }
 
 // Add creates a new item in the key/value store.
 func (c *Client) Add(item *Item) error {
-	return c.add(item)
+	return c.add(context.Background(), item)
+}
+
+// AddContext is like Add but honours the deadline and cancellation of ctx.
+func (c *Client) AddContext(ctx context.Context, item *Item) error {
+	return c.add(ctx, item)
 }
 
-func (c *Client) add(item *Item) error {
-	if ok := isKeyValid(item.Key); !ok {
-		return fmt.Errorf("given key is not valid")
+func (c *Client) add(ctx context.Context, item *Item) error {
+	defer c.near.invalidate(item.Key)
+
+	key, err := c.serverKey(item.Key)
+	if err != nil {
+		return err
 	}
 
-	cn, err := c.createReadWriter(item.Key)
+	item, err = c.compress("add", item)
 	if err != nil {
 		return err
 	}
 
-	return c.storageFn("add", cn, item)
+	if chunked, err := c.storeChunks(ctx, "add", key, item); chunked || err != nil {
+		return err
+	}
+
+	cn, err := c.createReadWriter(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return c.storageFn("add", cn, withKey(item, key))
 }
 
 // Replace replaces value for a given item's key.
 func (c *Client) Replace(item *Item) error {
-	return c.replace(item)
+	return c.replace(context.Background(), item)
+}
+
+// ReplaceContext is like Replace but honours the deadline and cancellation of ctx.
+func (c *Client) ReplaceContext(ctx context.Context, item *Item) error {
+	return c.replace(ctx, item)
 }
 
-func (c *Client) replace(item *Item) error {
-	if ok := isKeyValid(item.Key); !ok {
-		return fmt.Errorf("given key is not valid")
+func (c *Client) replace(ctx context.Context, item *Item) error {
+	defer c.near.invalidate(item.Key)
+
+	key, err := c.serverKey(item.Key)
+	if err != nil {
+		return err
 	}
 
-	cn, err := c.createReadWriter(item.Key)
+	item, err = c.compress("replace", item)
 	if err != nil {
 		return err
 	}
 
-	return c.storageFn("replace", cn, item)
+	if chunked, err := c.storeChunks(ctx, "replace", key, item); chunked || err != nil {
+		return err
+	}
+
+	cn, err := c.createReadWriter(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return c.storageFn("replace", cn, withKey(item, key))
 }
 
 // Append appends data to a given item.
 func (c *Client) Append(item *Item) error {
-	return c.append(item)
+	return c.append(context.Background(), item)
+}
+
+// AppendContext is like Append but honours the deadline and cancellation of ctx.
+func (c *Client) AppendContext(ctx context.Context, item *Item) error {
+	return c.append(ctx, item)
 }
 
-func (c *Client) append(item *Item) error {
-	if ok := isKeyValid(item.Key); !ok {
-		return fmt.Errorf("given key is not valid")
+func (c *Client) append(ctx context.Context, item *Item) error {
+	defer c.near.invalidate(item.Key)
+
+	key, err := c.serverKey(item.Key)
+	if err != nil {
+		return err
 	}
 
-	cn, err := c.createReadWriter(item.Key)
+	cn, err := c.createReadWriter(ctx, key)
 	if err != nil {
 		return err
 	}
 
-	return c.storageFn("append", cn, item)
+	return c.storageFn("append", cn, withKey(item, key))
 }
 
 // Prepend prepends data to a given item.
 func (c *Client) Prepend(item *Item) error {
-	return c.prepend(item)
+	return c.prepend(context.Background(), item)
 }
 
-func (c *Client) prepend(item *Item) error {
-	if ok := isKeyValid(item.Key); !ok {
-		return fmt.Errorf("given key is not valid")
+// PrependContext is like Prepend but honours the deadline and cancellation of ctx.
+func (c *Client) PrependContext(ctx context.Context, item *Item) error {
+	return c.prepend(ctx, item)
+}
+
+func (c *Client) prepend(ctx context.Context, item *Item) error {
+	defer c.near.invalidate(item.Key)
+
+	key, err := c.serverKey(item.Key)
+	if err != nil {
+		return err
 	}
 
-	cn, err := c.createReadWriter(item.Key)
+	cn, err := c.createReadWriter(ctx, key)
 	if err != nil {
 		return err
 	}
 
-	return c.storageFn("prepend", cn, item)
+	return c.storageFn("prepend", cn, withKey(item, key))
 }
 
 // CompareAndSwap sets the data if it is not updated since last fetch.
 func (c *Client) CompareAndSwap(item *Item) error {
-	return c.compareAndSwap(item)
+	return c.compareAndSwap(context.Background(), item)
+}
+
+// CompareAndSwapContext is like CompareAndSwap but honours the deadline and cancellation of ctx.
+func (c *Client) CompareAndSwapContext(ctx context.Context, item *Item) error {
+	return c.compareAndSwap(ctx, item)
 }
 
-func (c *Client) compareAndSwap(item *Item) error {
-	if ok := isKeyValid(item.Key); !ok {
-		return fmt.Errorf("given key is not valid")
+func (c *Client) compareAndSwap(ctx context.Context, item *Item) error {
+	defer c.near.invalidate(item.Key)
+
+	key, err := c.serverKey(item.Key)
+	if err != nil {
+		return err
+	}
+
+	item, err = c.compress("cas", item)
+	if err != nil {
+		return err
+	}
+
+	if chunked, err := c.storeChunks(ctx, "cas", key, item); chunked || err != nil {
+		return err
 	}
 
-	cn, err := c.createReadWriter(item.Key)
+	cn, err := c.createReadWriter(ctx, key)
 	if err != nil {
 		return err
 	}
 
-	return c.storageFn("cas", cn, item)
+	return c.storageFn("cas", cn, withKey(item, key))
 }
 
 // Gets returns an item for a given key.
 func (c *Client) Get(key string) (*Item, error) {
-	return c.get(key)
+	return c.get(context.Background(), key)
+}
+
+// GetContext is like Get but honours the deadline and cancellation of ctx.
+func (c *Client) GetContext(ctx context.Context, key string) (*Item, error) {
+	return c.get(ctx, key)
 }
 
-func (c *Client) get(key string) (*Item, error) {
-	if ok := isKeyValid(key); !ok {
-		return nil, errors.New("given key is not valid")
+func (c *Client) get(ctx context.Context, key string) (*Item, error) {
+	skey, err := c.serverKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if it, ok := c.near.get(key); ok {
+		return it, nil
+	}
+	version := c.near.currentVersion()
+
+	cn, err := c.createReadWriter(ctx, skey)
+	if err != nil {
+		return nil, err
 	}
 
-	cn, err := c.createReadWriter(key)
+	it, err := c.retrieveFn(ctx, "get", cn, skey, 0)
 	if err != nil {
 		return nil, err
 	}
+	it.Key = key
+	c.near.add(it, version)
 
-	return c.retrieveFn("get", cn, key)
+	return it, nil
 }
 
 // Gets returns an item for a given key with CAS value.
 func (c *Client) Gets(key string) (*Item, error) {
-	return c.gets(key)
+	return c.gets(context.Background(), key)
+}
+
+// GetsContext is like Gets but honours the deadline and cancellation of ctx.
+func (c *Client) GetsContext(ctx context.Context, key string) (*Item, error) {
+	return c.gets(ctx, key)
 }
 
-func (c *Client) gets(key string) (*Item, error) {
-	if ok := isKeyValid(key); !ok {
-		return nil, errors.New("given key is not valid")
+func (c *Client) gets(ctx context.Context, key string) (*Item, error) {
+	skey, err := c.serverKey(key)
+	if err != nil {
+		return nil, err
 	}
 
-	cn, err := c.createReadWriter(key)
+	cn, err := c.createReadWriter(ctx, skey)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.retrieveFn("gets", cn, key)
+	it, err := c.retrieveFn(ctx, "gets", cn, skey, 0)
+	if err != nil {
+		return nil, err
+	}
+	it.Key = key
+
+	return it, nil
+}
+
+// GetMulti returns items for the given keys.
+// Keys are grouped by server and each server is queried concurrently
+// with a single command. Missing keys are not present in the result.
+func (c *Client) GetMulti(keys []string) (map[string]*Item, error) {
+	return c.getMulti(context.Background(), "get", keys, 0)
+}
+
+// GetMultiContext is like GetMulti but honours the deadline and cancellation of ctx.
+func (c *Client) GetMultiContext(ctx context.Context, keys []string) (map[string]*Item, error) {
+	return c.getMulti(ctx, "get", keys, 0)
+}
+
+func (c *Client) getMulti(ctx context.Context, verb string, keys []string, ttl time.Duration) (map[string]*Item, error) {
+	userKeys := make(map[string]string, len(keys))
+	items := make(map[string]*Item, len(keys))
+	pending := make([]string, 0, len(keys))
+
+	// Only get is served by the near cache, the other verbs
+	// need the CAS values or the expiration updated by the servers.
+	useNear := verb == "get"
+	version := c.near.currentVersion()
+
+	for _, key := range keys {
+		skey, err := c.serverKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if useNear {
+			if it, ok := c.near.get(key); ok {
+				items[key] = it
+				continue
+			}
+		}
+		userKeys[skey] = key
+		pending = append(pending, skey)
+	}
+
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		keysByAddr := make(map[string][]string)
+
+		for _, skey := range pending {
+			addr, err := c.pickServer(skey)
+			if err != nil {
+				return nil, err
+			}
+
+			keysByAddr[addr.String()] = append(keysByAddr[addr.String()], skey)
+		}
+
+		var (
+			wg    sync.WaitGroup
+			retry []string
+		)
+
+		for addr, keys := range keysByAddr {
+			wg.Add(1)
+
+			go func(addr string, keys []string) {
+				defer wg.Done()
+
+				res, err := c.retrieveMultiConn(ctx, verb, addr, keys, ttl)
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				// The server might have been removed since it was picked,
+				// so the servers for its keys are picked once more.
+				if errors.Is(err, ErrPoolClosed) && attempt == 0 {
+					retry = append(retry, keys...)
+					return
+				}
+
+				if err != nil {
+					errs = append(errs, err)
+					return
+				}
+
+				for k, it := range res {
+					it.Key = userKeys[k]
+					items[it.Key] = it
+
+					if useNear {
+						c.near.add(it, version)
+					}
+				}
+			}(addr, keys)
+		}
+
+		wg.Wait()
+		pending = retry
+	}
+
+	return items, errors.Join(errs...)
+}
+
+// Touch updates the expiration of an item without fetching it.
+func (c *Client) Touch(key string, ttl time.Duration) error {
+	return c.touch(context.Background(), key, ttl)
+}
+
+// TouchContext is like Touch but honours the deadline and cancellation of ctx.
+func (c *Client) TouchContext(ctx context.Context, key string, ttl time.Duration) error {
+	return c.touch(ctx, key, ttl)
+}
+
+func (c *Client) touch(ctx context.Context, key string, ttl time.Duration) error {
+	key, err := c.serverKey(key)
+	if err != nil {
+		return err
+	}
+
+	cn, err := c.createReadWriter(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return c.touchFn(cn, key, ttl)
+}
+
+// GetAndTouch returns an item and updates its expiration to ttl.
+func (c *Client) GetAndTouch(key string, ttl time.Duration) (*Item, error) {
+	return c.getAndTouch(context.Background(), "gat", key, ttl)
+}
+
+// GetAndTouchContext is like GetAndTouch but honours the deadline and cancellation of ctx.
+func (c *Client) GetAndTouchContext(ctx context.Context, key string, ttl time.Duration) (*Item, error) {
+	return c.getAndTouch(ctx, "gat", key, ttl)
+}
+
+// GetsAndTouch is like GetAndTouch but also returns the CAS value of the item.
+func (c *Client) GetsAndTouch(key string, ttl time.Duration) (*Item, error) {
+	return c.getAndTouch(context.Background(), "gats", key, ttl)
+}
+
+// GetsAndTouchContext is like GetsAndTouch but honours the deadline and cancellation of ctx.
+func (c *Client) GetsAndTouchContext(ctx context.Context, key string, ttl time.Duration) (*Item, error) {
+	return c.getAndTouch(ctx, "gats", key, ttl)
+}
+
+func (c *Client) getAndTouch(ctx context.Context, verb string, key string, ttl time.Duration) (*Item, error) {
+	skey, err := c.serverKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	cn, err := c.createReadWriter(ctx, skey)
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := c.retrieveFn(ctx, verb, cn, skey, ttl)
+	if err != nil {
+		return nil, err
+	}
+	it.Key = key
+
+	return it, nil
+}
+
+// GetAndTouchMulti returns items for the given keys and updates their expiration to ttl.
+// Missing keys are not present in the result.
+func (c *Client) GetAndTouchMulti(keys []string, ttl time.Duration) (map[string]*Item, error) {
+	return c.getMulti(context.Background(), "gat", keys, ttl)
+}
+
+// GetAndTouchMultiContext is like GetAndTouchMulti but honours the deadline and cancellation of ctx.
+func (c *Client) GetAndTouchMultiContext(ctx context.Context, keys []string, ttl time.Duration) (map[string]*Item, error) {
+	return c.getMulti(ctx, "gat", keys, ttl)
+}
+
+// GetsAndTouchMulti is like GetAndTouchMulti but also returns the CAS values of the items.
+func (c *Client) GetsAndTouchMulti(keys []string, ttl time.Duration) (map[string]*Item, error) {
+	return c.getMulti(context.Background(), "gats", keys, ttl)
+}
+
+// GetsAndTouchMultiContext is like GetsAndTouchMulti but honours the deadline and cancellation of ctx.
+func (c *Client) GetsAndTouchMultiContext(ctx context.Context, keys []string, ttl time.Duration) (map[string]*Item, error) {
+	return c.getMulti(ctx, "gats", keys, ttl)
 }
 
 // Delete remove a key from the key/value store.
 func (c *Client) Delete(key string) error {
-	return c.delete(key)
+	return c.delete(context.Background(), key)
+}
+
+// DeleteContext is like Delete but honours the deadline and cancellation of ctx.
+func (c *Client) DeleteContext(ctx context.Context, key string) error {
+	return c.delete(ctx, key)
 }
 
-func (c *Client) delete(key string) error {
-	if ok := isKeyValid(key); !ok {
-		return errors.New("given key is not valid")
+func (c *Client) delete(ctx context.Context, key string) error {
+	defer c.near.invalidate(key)
+
+	key, err := c.serverKey(key)
+	if err != nil {
+		return err
 	}
 
-	cn, err := c.createReadWriter(key)
+	cn, err := c.createReadWriter(ctx, key)
 	if err != nil {
 		return err
 	}
@@ -242,15 +627,23 @@ func (c *Client) delete(key string) error {
 
 // Incr increments a numerical value for a given key with a given delta.
 func (c *Client) Incr(key string, delta uint64) (uint64, error) {
-	return c.incr(key, delta)
+	return c.incr(context.Background(), key, delta)
+}
+
+// IncrContext is like Incr but honours the deadline and cancellation of ctx.
+func (c *Client) IncrContext(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return c.incr(ctx, key, delta)
 }
 
-func (c *Client) incr(key string, delta uint64) (uint64, error) {
-	if ok := isKeyValid(key); !ok {
-		return 0, errors.New("given key is not valid")
+func (c *Client) incr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	defer c.near.invalidate(key)
+
+	key, err := c.serverKey(key)
+	if err != nil {
+		return 0, err
 	}
 
-	cn, err := c.createReadWriter(key)
+	cn, err := c.createReadWriter(ctx, key)
 	if err != nil {
 		return 0, err
 	}
@@ -260,15 +653,23 @@ func (c *Client) incr(key string, delta uint64) (uint64, error) {
 
 // Decr decrements a numerical value for a given key with a given delta.
 func (c *Client) Decr(key string, delta uint64) (uint64, error) {
-	return c.decr(key, delta)
+	return c.decr(context.Background(), key, delta)
 }
 
-func (c *Client) decr(key string, delta uint64) (uint64, error) {
-	if ok := isKeyValid(key); !ok {
-		return 0, errors.New("given key is not valid")
+// DecrContext is like Decr but honours the deadline and cancellation of ctx.
+func (c *Client) DecrContext(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return c.decr(ctx, key, delta)
+}
+
+func (c *Client) decr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	defer c.near.invalidate(key)
+
+	key, err := c.serverKey(key)
+	if err != nil {
+		return 0, err
 	}
 
-	cn, err := c.createReadWriter(key)
+	cn, err := c.createReadWriter(ctx, key)
 	if err != nil {
 		return 0, err
 	}
@@ -276,13 +677,15 @@ func (c *Client) decr(key string, delta uint64) (uint64, error) {
 	return c.incrDecrFn("decr", cn, key, delta)
 }
 
+// isKeyValid reports whether the key can be sent in a text command.
+// Keys have 1 to 250 bytes without spaces and control characters.
 func isKeyValid(key string) bool {
-	if len(key) > 250 {
+	if len(key) == 0 || len(key) > 250 {
 		return false
 	}
 
-	for _, c := range key {
-		if c == ' ' || c == '\n' {
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
 			return false
 		}
 	}
@@ -291,9 +694,207 @@ func isKeyValid(key string) bool {
 }
 
 func (c *Client) storageFn(verb string, cn *Connection, item *Item) error {
-	var cmd string
+	err := c.protocol.store(cn, verb, item)
+	c.putBackConnection(cn, err)
+
+	return cn.wrapError(verb, err)
+}
+
+func (c *Client) createReadWriter(ctx context.Context, key string) (*Connection, error) {
+	addr, err := c.pickServer(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Look into cache for a connection
+	cn, err := c.getFreeConn(ctx, addr.String())
+
+	// The server might have been removed in the meantime,
+	// so pick the server for the key once more.
+	if errors.Is(err, ErrPoolClosed) {
+		if addr, err = c.pickServer(key); err != nil {
+			return nil, err
+		}
+
+		cn, err = c.getFreeConn(ctx, addr.String())
+	}
+
+	return cn, err
+}
+
+// pickServer returns the server responsible for the key. With failover
+// the keys of a server marked down go to the next server which is up.
+func (c *Client) pickServer(key string) (net.Addr, error) {
+	addr, err := c.router.PickServer(key)
+	if err != nil || !c.failover || !c.isDown(addr) {
+		return addr, err
+	}
 
-	defer c.putBackConnection(cn)
+	fs, ok := c.router.(FailoverSelector)
+	if !ok {
+		return addr, nil
+	}
+
+	addrs, err := fs.PickServers(key)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, next := range addrs {
+		if !c.isDown(next) {
+			return next, nil
+		}
+	}
+
+	// Every server is down, fail on the one owning the key.
+	return addr, nil
+}
+
+func (c *Client) isDown(addr net.Addr) bool {
+	c.mu.Lock()
+	p, ok := c.pools[addr.String()]
+	c.mu.Unlock()
+
+	return ok && p.isDown()
+}
+
+// getFreeConn takes a connection to the given address out of the pool.
+// The connection's deadline is taken from the context or from the client's timeout.
+func (c *Client) getFreeConn(ctx context.Context, addr string) (*Connection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	p, ok := c.pools[addr]
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, ErrPoolClosed
+	}
+
+	cn, err := p.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cn.setContext(ctx, c.timeout); err != nil {
+		c.putBackConnection(cn, err)
+		return nil, err
+	}
+
+	return cn, nil
+}
+
+// putBackConnection returns the connection to its pool.
+// If the operation failed in a way that could leave
+// the connection out of sync, it is closed instead.
+func (c *Client) putBackConnection(cn *Connection, err error) {
+	interrupted := cn.clearContext()
+
+	if cn.shared != nil {
+		cn.shared.release(cn, err, interrupted)
+		return
+	}
+
+	if resumableError(err) {
+		cn.pool.put(cn)
+	} else {
+		cn.pool.discard(cn, err, interrupted)
+	}
+}
+
+// resumableError reports whether the connection can be reused
+// after the error, i.e. the server replied with a complete response.
+func resumableError(err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrCacheMiss), errors.Is(err, ErrNotStored), errors.Is(err, ErrExists),
+		errors.Is(err, ErrError), errors.Is(err, ErrClientError), errors.Is(err, ErrServerError),
+		errors.Is(err, ErrNotSupported):
+		return true
+	}
+
+	return false
+}
+
+// closeConnection closes a connection the server has closed,
+// it is not counted as a failure of the server.
+func (c *Client) closeConnection(cn *Connection) {
+	cn.clearContext()
+
+	if cn.shared != nil {
+		cn.shared.release(cn, net.ErrClosed, true)
+		return
+	}
+
+	cn.pool.discard(cn, nil, true)
+}
+
+// setContext applies the deadline of the context to the connection
+// and interrupts any pending I/O once the context is cancelled.
+func (cn *Connection) setContext(ctx context.Context, timeout time.Duration) error {
+	var deadline time.Time
+
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+
+	// Other operations may be reading from a shared connection,
+	// the read deadline is set once it is our turn to read.
+	if cn.shared != nil {
+		cn.ctx = ctx
+		cn.deadline = deadline
+		return cn.conn.SetWriteDeadline(deadline)
+	}
+
+	if err := cn.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	cn.stop = context.AfterFunc(ctx, func() {
+		cn.conn.SetDeadline(time.Now())
+	})
+
+	return nil
+}
+
+// clearContext reports whether the connection was interrupted
+// because the context got cancelled.
+func (cn *Connection) clearContext() bool {
+	if cn.stop == nil {
+		return false
+	}
+
+	interrupted := !cn.stop()
+	cn.stop = nil
+
+	return interrupted
+}
+
+// textProtocol implements the classic text protocol.
+type textProtocol struct{}
+
+func (textProtocol) store(cn *Connection, verb string, item *Item) error {
+	if err := writeStorageCommand(cn.rw, verb, item); err != nil {
+		return err
+	}
+
+	if err := cn.flush(); err != nil {
+		return err
+	}
+
+	return parseStorageResponse(cn.rw)
+}
+
+// writeStorageCommand buffers the command along with the data block.
+func writeStorageCommand(rw *bufio.ReadWriter, verb string, item *Item) error {
+	var cmd string
 
 	if verb == "cas" {
 		cmd = fmt.Sprintf("%s %s %d %d %d %d\r\n",
@@ -303,65 +904,228 @@ func (c *Client) storageFn(verb string, cn *Connection, item *Item) error {
 			verb, item.Key, item.Flags, int(item.Expiration.Seconds()), len(item.Value))
 	}
 
-	if _, err := fmt.Fprint(cn.rw, cmd); err != nil {
+	if _, err := fmt.Fprint(rw, cmd); err != nil {
 		return err
 	}
 
-	if _, err := cn.rw.Write(item.Value); err != nil {
+	if _, err := rw.Write(item.Value); err != nil {
 		return err
 	}
-	if _, err := cn.rw.Write([]byte("\r\n")); err != nil {
-		return err
+	_, err := rw.Write([]byte("\r\n"))
+
+	return err
+}
+
+func (textProtocol) incrDecr(cn *Connection, verb string, key string, delta uint64) (uint64, error) {
+	cmd := fmt.Sprintf("%s %s %d\r\n", verb, key, delta)
+
+	line, err := writeFlushRead(cn, cmd)
+	if err != nil {
+		return 0, err
+	}
+
+	return parseIncrDecr(line)
+}
+
+func (p textProtocol) retrieve(cn *Connection, verb string, key string, ttl time.Duration) (*Item, error) {
+	items, err := p.retrieveMulti(cn, verb, []string{key}, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	it, ok := items[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+
+	return it, nil
+}
+
+func (textProtocol) retrieveMulti(cn *Connection, verb string, keys []string, ttl time.Duration) (map[string]*Item, error) {
+	cmd := fmt.Sprintf("%s %s\r\n", verb, strings.Join(keys, " "))
+	if verb == "gat" || verb == "gats" {
+		cmd = fmt.Sprintf("%s %d %s\r\n", verb, int(ttl.Seconds()), strings.Join(keys, " "))
+	}
+
+	if _, err := fmt.Fprint(cn.rw, cmd); err != nil {
+		return nil, err
+	}
+
+	if err := cn.flush(); err != nil {
+		return nil, err
 	}
-	if err := cn.rw.Flush(); err != nil {
+
+	items := make(map[string]*Item, len(keys))
+	err := readItems(cn.rw, func(it *Item) {
+		items[it.Key] = it
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (textProtocol) delete(cn *Connection, key string) error {
+	cmd := fmt.Sprintf("delete %s\r\n", key)
+
+	line, err := writeFlushRead(cn, cmd)
+	if err != nil {
 		return err
 	}
 
-	if err := parseStorageResponse(cn.rw); err != nil {
+	if err := parseDelete(line); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (c *Client) createReadWriter(key string) (*Connection, error) {
-	addr, err := c.router.pickServer(key)
+func (textProtocol) touch(cn *Connection, key string, ttl time.Duration) error {
+	cmd := fmt.Sprintf("touch %s %d\r\n", key, int(ttl.Seconds()))
+
+	line, err := writeFlushRead(cn, cmd)
 	if err != nil {
+		return err
+	}
+
+	return parseTouch(line)
+}
+
+// storeMulti and touchMulti send meta commands in the quiet mode,
+// so the items are only answered when they fail.
+func (textProtocol) storeMulti(cn *Connection, items []*Item) (map[int]error, error) {
+	return storeMultiQuiet(cn, items, plainKey)
+}
+
+// deleteMulti waits for the reply of every command, because the quiet mode
+// of md suppresses NF along with HD, so the missing keys would not be reported.
+func (textProtocol) deleteMulti(cn *Connection, keys []string) (map[int]error, error) {
+	return pipeline(cn, len(keys), func(i int) error {
+		_, err := fmt.Fprintf(cn.rw, "delete %s\r\n", keys[i])
+		return err
+	}, func(rw *bufio.ReadWriter) error {
+		line, err := rw.ReadSlice('\n')
+		if err != nil {
+			return err
+		}
+		return parseDelete(line)
+	})
+}
+
+func (textProtocol) touchMulti(cn *Connection, keys []string, ttl time.Duration) (map[int]error, error) {
+	return touchMultiQuiet(cn, keys, ttl, plainKey)
+}
+
+func plainKey(key string) string {
+	return key
+}
+
+// pipeline buffers n commands, sends them with a single flush and reads
+// their replies in order. The errors reported for the commands are returned
+// by their index, the ones breaking the connection end the pipeline.
+func pipeline(cn *Connection, n int, write func(i int) error, read func(*bufio.ReadWriter) error) (map[int]error, error) {
+	for i := 0; i < n; i++ {
+		if err := write(i); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cn.flush(); err != nil {
 		return nil, err
 	}
 
-	// Look into cache for a connection
-	if conn := c.getFreeConn(addr.String()); conn != nil {
-		return conn, nil
+	errs := make(map[int]error)
+	for i := 0; i < n; i++ {
+		err := read(cn.rw)
+		if !resumableError(err) {
+			return nil, err
+		}
+		if err != nil {
+			errs[i] = err
+		}
 	}
 
-	return nil, nil
+	return errs, nil
 }
 
-func (c *Client) getFreeConn(addr string) *Connection {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+func (textProtocol) version(cn *Connection) (string, error) {
+	line, err := writeFlushRead(cn, "version\r\n")
+	if err != nil {
+		return "", err
+	}
 
-	for {
-		for i, cn := range c.connPool[addr] {
-			c.connPool[addr] = c.connPool[addr][i+1:]
-			cn.owner = addr
+	if !bytes.HasPrefix(line, []byte("VERSION ")) {
+		return "", parseErrorLine(line)
+	}
 
-			// fmt.Println("Len 1cn:", len(c.connPool[cn.owner]))
+	return string(bytes.TrimSpace(line[8:])), nil
+}
 
-			return cn
-		}
+func (textProtocol) flushAll(cn *Connection, delay time.Duration) error {
+	return writeFlushOK(cn, fmt.Sprintf("flush_all %d\r\n", int(delay.Seconds())))
+}
+
+func (textProtocol) verbosity(cn *Connection, level int) error {
+	return writeFlushOK(cn, fmt.Sprintf("verbosity %d\r\n", level))
+}
+
+func (textProtocol) cacheMemLimit(cn *Connection, mb int) error {
+	return writeFlushOK(cn, fmt.Sprintf("cache_memlimit %d\r\n", mb))
+}
 
-		time.Sleep(10 * time.Millisecond)
+func (textProtocol) shutdown(cn *Connection) error {
+	line, err := writeFlushRead(cn, "shutdown\r\n")
+	if errors.Is(err, io.EOF) {
+		return nil
 	}
+	if err != nil {
+		return err
+	}
+
+	return parseErrorLine(line)
 }
 
-func (c *Client) putBackConnection(cn *Connection) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// auth is not supported, memcached accepts SASL with the binary protocol only.
+func (textProtocol) auth(cn *Connection, username, password string) error {
+	return ErrNotSupported
+}
+
+func (textProtocol) stats(cn *Connection, group string) (map[string]string, error) {
+	cmd := "stats\r\n"
+	if group != "" {
+		cmd = fmt.Sprintf("stats %s\r\n", group)
+	}
 
-	c.connPool[cn.owner] = append(c.connPool[cn.owner], cn)
-	cn.owner = ""
+	if _, err := fmt.Fprint(cn.rw, cmd); err != nil {
+		return nil, err
+	}
+
+	if err := cn.flush(); err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]string)
+	for {
+		line, err := cn.rw.ReadSlice('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		if bytes.Equal(line, []byte("END\r\n")) {
+			return stats, nil
+		}
+
+		fields := strings.SplitN(strings.TrimSpace(string(line)), " ", 3)
+		if fields[0] != "STAT" {
+			return nil, parseErrorLine(line)
+		}
+		if len(fields) != 3 {
+			return nil, malformedResponse(strings.TrimSpace(string(line)))
+		}
+
+		stats[fields[1]] = fields[2]
+	}
 }
 
 func parseStorageResponse(rw *bufio.ReadWriter) error {
@@ -373,32 +1137,27 @@ func parseStorageResponse(rw *bufio.ReadWriter) error {
 	switch {
 	case bytes.Equal(line, []byte("STORED\r\n")):
 		return nil
-	case bytes.Equal(line, []byte("ERROR\r\n")):
-		return ErrError
 	case bytes.Equal(line, []byte("NOT_STORED\r\n")):
 		return ErrNotStored
-	case bytes.Equal(line, []byte("CLIENT_ERROR\r\n")):
-		return ErrClientError
 	case bytes.Equal(line, []byte("EXISTS\r\n")):
 		return ErrExists
 	case bytes.Equal(line, []byte("NOT_FOUND\r\n")):
 		return ErrCacheMiss
 	default:
-		// This should not happen.
-		panic(string(line) + " is not a valid response")
+		return parseErrorLine(line)
 	}
 }
 
-func writeFlushRead(rw *bufio.ReadWriter, cmd string) ([]byte, error) {
-	if _, err := fmt.Fprint(rw, cmd); err != nil {
+func writeFlushRead(cn *Connection, cmd string) ([]byte, error) {
+	if _, err := fmt.Fprint(cn.rw, cmd); err != nil {
 		return nil, err
 	}
 
-	if err := rw.Flush(); err != nil {
+	if err := cn.flush(); err != nil {
 		return nil, err
 	}
 
-	line, err := rw.ReadSlice('\n')
+	line, err := cn.rw.ReadSlice('\n')
 	if err != nil {
 		return nil, err
 	}
@@ -406,71 +1165,66 @@ func writeFlushRead(rw *bufio.ReadWriter, cmd string) ([]byte, error) {
 	return line, nil
 }
 
-func (c *Client) incrDecrFn(verb string, cn *Connection, key string, delta uint64) (uint64, error) {
-	defer c.putBackConnection(cn)
-
-	cmd := fmt.Sprintf("%s %s %d\r\n", verb, key, delta)
-
-	line, err := writeFlushRead(cn.rw, cmd)
+// writeFlushOK sends a command which is answered with OK.
+func writeFlushOK(cn *Connection, cmd string) error {
+	line, err := writeFlushRead(cn, cmd)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	return parseIncrDecr(line)
+	if !bytes.Equal(line, []byte("OK\r\n")) {
+		return parseErrorLine(line)
+	}
+
+	return nil
 }
 
-func (c *Client) retrieveFn(verb string, cn *Connection, key string) (*Item, error) {
-	var cmd string
+func (c *Client) incrDecrFn(verb string, cn *Connection, key string, delta uint64) (uint64, error) {
+	res, err := c.protocol.incrDecr(cn, verb, key, delta)
+	c.putBackConnection(cn, err)
 
-	defer c.putBackConnection(cn)
+	return res, cn.wrapError(verb, err)
+}
 
-	if verb == "gets" {
-		cmd = fmt.Sprintf("%s %s\r\n", verb, key)
-	} else {
-		cmd = fmt.Sprintf("%s %s\r\n", verb, key)
-	}
+func (c *Client) retrieveFn(ctx context.Context, verb string, cn *Connection, key string, ttl time.Duration) (*Item, error) {
+	res, err := c.protocol.retrieve(cn, verb, key, ttl)
+	c.putBackConnection(cn, err)
 
-	line, err := writeFlushRead(cn.rw, cmd)
-	if err != nil {
-		return nil, err
+	if err == nil {
+		res, err = c.unpack(ctx, verb, res, ttl)
 	}
 
-	it, err := parseGetResponse(line)
-	if err != nil && errors.Is(err, ErrCacheMiss) {
-		return nil, err
-	}
+	return res, cn.wrapError(verb, err)
+}
 
-	val, err := cn.rw.ReadSlice('\n')
+func (c *Client) retrieveMultiConn(ctx context.Context, verb string, addr string, keys []string, ttl time.Duration) (map[string]*Item, error) {
+	cn, err := c.getFreeConn(ctx, addr)
 	if err != nil {
 		return nil, err
 	}
 
-	// To get rid of the CRLF
-	it.Value = val[:len(val)-2]
+	res, err := c.protocol.retrieveMulti(cn, verb, keys, ttl)
+	c.putBackConnection(cn, err)
 
-	// Parse the final END\r\n
-	if _, err := cn.rw.ReadSlice('\n'); err != nil {
-		return nil, err
+	if err == nil {
+		err = c.unpackMulti(ctx, verb, res, ttl)
 	}
 
-	return it, nil
+	return res, cn.wrapError(verb, err)
 }
 
-func (c *Client) deleteFn(verb string, cn *Connection, key string) error {
-	cmd := fmt.Sprintf("%s %s\r\n", verb, key)
-
-	defer c.putBackConnection(cn)
+func (c *Client) touchFn(cn *Connection, key string, ttl time.Duration) error {
+	err := c.protocol.touch(cn, key, ttl)
+	c.putBackConnection(cn, err)
 
-	line, err := writeFlushRead(cn.rw, cmd)
-	if err != nil {
-		return err
-	}
+	return cn.wrapError("touch", err)
+}
 
-	if err := parseDelete(line); err != nil {
-		return err
-	}
+func (c *Client) deleteFn(verb string, cn *Connection, key string) error {
+	err := c.protocol.delete(cn, key)
+	c.putBackConnection(cn, err)
 
-	return nil
+	return cn.wrapError(verb, err)
 }
 
 func parseDelete(resp []byte) error {
@@ -482,43 +1236,103 @@ func parseDelete(resp []byte) error {
 	case bytes.Equal(resp, []byte("NOT_FOUND\r\n")):
 		return ErrCacheMiss
 	default:
-		// This should not happen.
-		panic(string(resp) + " is not a valid response")
+		return parseErrorLine(resp)
 	}
 }
 
-func parseIncrDecr(resp []byte) (uint64, error) {
+func parseTouch(resp []byte) error {
 	switch {
+	case bytes.Equal(resp, []byte("TOUCHED\r\n")):
+		return nil
 	case bytes.Equal(resp, []byte("NOT_FOUND\r\n")):
+		return ErrCacheMiss
+	default:
+		return parseErrorLine(resp)
+	}
+}
+
+func parseIncrDecr(resp []byte) (uint64, error) {
+	if bytes.Equal(resp, []byte("NOT_FOUND\r\n")) {
 		return 0, ErrCacheMiss
-	case bytes.HasPrefix(resp, []byte("CLIENT_ERROR ")):
-		return 0, fmt.Errorf(string(resp[13:]))
 	}
 
-	return strconv.ParseUint(string(resp[:len(resp)-2]), 10, 64)
+	n, err := strconv.ParseUint(string(bytes.TrimSuffix(resp, []byte("\r\n"))), 10, 64)
+	if err != nil {
+		return 0, parseErrorLine(resp)
+	}
+
+	return n, nil
 }
 
-func parseGetResponse(resp []byte) (*Item, error) {
-	if bytes.Equal(resp, []byte("END\r\n")) {
-		return nil, ErrCacheMiss
+// readItems reads the VALUE lines with their data blocks up to the final END.
+func readItems(rw *bufio.ReadWriter, fn func(*Item)) error {
+	for {
+		line, err := rw.ReadSlice('\n')
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(line, []byte("END\r\n")) {
+			return nil
+		}
+
+		if !bytes.HasPrefix(line, []byte("VALUE ")) {
+			return parseErrorLine(line)
+		}
+
+		it, size, err := parseGetResponse(line)
+		if err != nil {
+			return err
+		}
+
+		// The data block is followed by CRLF.
+		val := make([]byte, size+2)
+		if _, err := io.ReadFull(rw, val); err != nil {
+			return err
+		}
+
+		if !bytes.HasSuffix(val, []byte("\r\n")) {
+			return malformedResponse(fmt.Sprintf("data block of %q is not terminated by CRLF", it.Key))
+		}
+
+		it.Value = val[:size]
+		fn(it)
 	}
+}
 
-	splitResp := strings.Split(string(resp), " ")
+// maxValueSize is the largest value the servers can be configured to store.
+// Larger sizes in a response are rejected before the value is allocated.
+const maxValueSize = 1 << 30
 
-	flags, _ := strconv.Atoi(splitResp[2])
+func parseGetResponse(resp []byte) (*Item, int, error) {
+	splitResp := strings.Fields(string(resp))
 
-	if len(splitResp) == 5 {
-		cas, _ := strconv.Atoi(splitResp[4])
+	if len(splitResp) < 4 || len(splitResp) > 5 || splitResp[0] != "VALUE" {
+		return nil, 0, malformedResponse(string(bytes.TrimSpace(resp)))
+	}
 
-		return &Item{
-			Key:   splitResp[1],
-			Flags: int32(flags),
-			CAS:   int64(cas),
-		}, nil
+	flags, err := strconv.ParseUint(splitResp[2], 10, 32)
+	if err != nil {
+		return nil, 0, malformedResponse(string(bytes.TrimSpace(resp)))
 	}
 
-	return &Item{
+	size, err := strconv.Atoi(splitResp[3])
+	if err != nil || size < 0 || size > maxValueSize {
+		return nil, 0, malformedResponse(string(bytes.TrimSpace(resp)))
+	}
+
+	it := &Item{
 		Key:   splitResp[1],
 		Flags: int32(flags),
-	}, nil
+	}
+
+	if len(splitResp) == 5 {
+		cas, err := strconv.ParseInt(splitResp[4], 10, 64)
+		if err != nil {
+			return nil, 0, malformedResponse(string(bytes.TrimSpace(resp)))
+		}
+		it.CAS = cas
+	}
+
+	return it, size, nil
 }
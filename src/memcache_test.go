@@ -23,6 +23,8 @@
 package memcache
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -30,6 +32,7 @@ import (
 )
 
 const defaultAddr = "127.0.0.1:11211"
+const secondAddr = "127.0.0.1:11212"
 
 var _ = Describe("Memcache Client Tests", Label("StorageCommands"), func() {
 	var mc *Client
@@ -158,6 +161,79 @@ var _ = Describe("Memcache Client Tests", Label("StorageCommands"), func() {
 		By("Trying to increment a key whose value is not numeric")
 		_, err = mc.Incr(it1.Key, 100)
 		Expect(err).To(HaveOccurred())
-		Expect(err.Error()).To(Equal("cannot increment or decrement non-numeric value\r\n"))
+		Expect(err).To(MatchError(ErrClientError))
+
+		var merr *Error
+		Expect(errors.As(err, &merr)).To(BeTrue())
+		Expect(merr.Verb).To(Equal("incr"))
+		Expect(merr.Addr).To(Equal(defaultAddr))
+		Expect(merr.Msg).To(Equal("cannot increment or decrement non-numeric value"))
+	})
+	It("GetMulti with a working client", func() {
+		By("Setting a few items including a large multi-line value")
+		large := []byte(strings.Repeat("multi\r\nline ", 1000))
+		Expect(mc.Set(&Item{Key: "multi_1", Value: []byte("one"), Expiration: time.Second * 60})).To(Succeed())
+		Expect(mc.Set(&Item{Key: "multi_2", Value: large, Expiration: time.Second * 60, Flags: 3})).To(Succeed())
+
+		By("Get on the large value returns it whole")
+		it, err := mc.Get("multi_2")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal(large))
+
+		By("GetMulti returns only the existing keys")
+		items, err := mc.GetMulti([]string{"multi_1", "multi_2", "multi_missing"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(items).To(HaveLen(2))
+		Expect(items["multi_1"].Value).To(Equal([]byte("one")))
+		Expect(items["multi_2"].Value).To(Equal(large))
+		Expect(items["multi_2"].Flags).To(Equal(int32(3)))
+
+		By("GetMulti with an invalid key fails")
+		_, err = mc.GetMulti([]string{"multi_1", "invalid key"})
+		Expect(err).To(HaveOccurred())
+	})
+	It("Touch commands with a working client", func() {
+		ttl := func(key string) time.Duration {
+			res, err := mc.MetaGet(key, MetaReturnTTL)
+			Expect(err).ToNot(HaveOccurred())
+			return res.TTL
+		}
+
+		Expect(mc.Set(&Item{Key: "touch_1", Value: []byte("one"), Expiration: time.Second * 60})).To(Succeed())
+		Expect(mc.Set(&Item{Key: "touch_2", Value: []byte("two"), Expiration: time.Second * 60})).To(Succeed())
+
+		By("Touch extends the expiration without fetching the item")
+		Expect(mc.Touch("touch_1", time.Hour)).To(Succeed())
+		Expect(ttl("touch_1")).To(BeNumerically(">", time.Minute))
+		Expect(mc.Touch("touch_missing", time.Hour)).To(MatchError(ErrCacheMiss))
+
+		By("GetAndTouch returns the item and extends its expiration")
+		it, err := mc.GetAndTouch("touch_2", time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("two")))
+		Expect(it.CAS).To(BeZero())
+		Expect(ttl("touch_2")).To(BeNumerically(">", time.Minute))
+
+		By("GetsAndTouch also returns the CAS value")
+		it, err = mc.GetsAndTouch("touch_2", time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.CAS).ToNot(BeZero())
+		Expect(ttl("touch_2")).To(BeNumerically("<=", time.Minute))
+
+		_, err = mc.GetAndTouch("touch_missing", time.Hour)
+		Expect(err).To(MatchError(ErrCacheMiss))
+
+		By("The multi variants touch only the existing keys")
+		items, err := mc.GetsAndTouchMulti([]string{"touch_1", "touch_2", "touch_missing"}, time.Hour*2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(items).To(HaveLen(2))
+		Expect(items["touch_1"].CAS).ToNot(BeZero())
+		Expect(ttl("touch_1")).To(BeNumerically(">", time.Hour))
+		Expect(ttl("touch_2")).To(BeNumerically(">", time.Hour))
+
+		items, err = mc.GetAndTouchMulti([]string{"touch_1"}, time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(items["touch_1"].Value).To(Equal([]byte("one")))
+		Expect(ttl("touch_1")).To(BeNumerically("<=", time.Minute))
 	})
 })
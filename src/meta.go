@@ -0,0 +1,574 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Flags without an argument which can be passed to the meta commands.
+var (
+	MetaBase64Key        = MetaFlag{token: 'b'}
+	MetaReturnCAS        = MetaFlag{token: 'c'}
+	MetaReturnFlags      = MetaFlag{token: 'f'}
+	MetaReturnHit        = MetaFlag{token: 'h'}
+	MetaReturnKey        = MetaFlag{token: 'k'}
+	MetaReturnLastAccess = MetaFlag{token: 'l'}
+	MetaQuiet            = MetaFlag{token: 'q'}
+	MetaReturnSize       = MetaFlag{token: 's'}
+	MetaReturnTTL        = MetaFlag{token: 't'}
+	MetaNoLRUBump        = MetaFlag{token: 'u'}
+	MetaReturnValue      = MetaFlag{token: 'v'}
+	MetaInvalidate       = MetaFlag{token: 'I'}
+	MetaRemoveValue      = MetaFlag{token: 'x'}
+)
+
+// MetaMode selects the mode of the ms and ma commands.
+type MetaMode byte
+
+const (
+	MetaModeSet     MetaMode = 'S'
+	MetaModeAdd     MetaMode = 'E'
+	MetaModeAppend  MetaMode = 'A'
+	MetaModePrepend MetaMode = 'P'
+	MetaModeReplace MetaMode = 'R'
+	MetaModeIncr    MetaMode = 'I'
+	MetaModeDecr    MetaMode = 'D'
+)
+
+// MetaOpaque returns a flag with an opaque token which is echoed back by the server.
+func MetaOpaque(token string) MetaFlag {
+	return MetaFlag{token: 'O', arg: token}
+}
+
+// MetaTTL returns a flag which updates the TTL of the item.
+func MetaTTL(ttl time.Duration) MetaFlag {
+	return MetaFlag{token: 'T', arg: strconv.Itoa(int(ttl.Seconds()))}
+}
+
+// MetaVivify returns a flag which creates an empty item on miss with the given TTL.
+func MetaVivify(ttl time.Duration) MetaFlag {
+	return MetaFlag{token: 'N', arg: strconv.Itoa(int(ttl.Seconds()))}
+}
+
+// MetaRecache returns a flag which makes the client win the recache
+// if the remaining TTL is lower than the given threshold.
+func MetaRecache(threshold time.Duration) MetaFlag {
+	return MetaFlag{token: 'R', arg: strconv.Itoa(int(threshold.Seconds()))}
+}
+
+// MetaCompareCAS returns a flag which makes the command fail
+// if the item's CAS value does not match.
+func MetaCompareCAS(cas int64) MetaFlag {
+	return MetaFlag{token: 'C', arg: strconv.FormatInt(cas, 10)}
+}
+
+// MetaNewCAS returns a flag which sets the CAS value of a modified item.
+func MetaNewCAS(cas int64) MetaFlag {
+	return MetaFlag{token: 'E', arg: strconv.FormatInt(cas, 10)}
+}
+
+// MetaClientFlags returns a flag which sets the client flags of a stored item.
+func MetaClientFlags(flags int32) MetaFlag {
+	return MetaFlag{token: 'F', arg: strconv.FormatInt(int64(flags), 10)}
+}
+
+// MetaSetMode returns a flag which selects the mode of the ms or ma command.
+func MetaSetMode(mode MetaMode) MetaFlag {
+	return MetaFlag{token: 'M', arg: string(mode)}
+}
+
+// MetaDelta returns a flag which sets the delta of the ma command.
+func MetaDelta(delta uint64) MetaFlag {
+	return MetaFlag{token: 'D', arg: strconv.FormatUint(delta, 10)}
+}
+
+// MetaInitialValue returns a flag which sets the value
+// the ma command uses when an item is autovivified.
+func MetaInitialValue(value uint64) MetaFlag {
+	return MetaFlag{token: 'J', arg: strconv.FormatUint(value, 10)}
+}
+
+// String returns the flag as it is sent to the server.
+func (f MetaFlag) String() string {
+	return string(f.token) + f.arg
+}
+
+// MetaGet retrieves an item using the mg command.
+// The returned fields depend on the flags provided.
+func (c *Client) MetaGet(key string, flags ...MetaFlag) (*MetaResult, error) {
+	return c.metaGet(context.Background(), key, flags)
+}
+
+// MetaGetContext is like MetaGet but honours the deadline and cancellation of ctx.
+func (c *Client) MetaGetContext(ctx context.Context, key string, flags ...MetaFlag) (*MetaResult, error) {
+	return c.metaGet(ctx, key, flags)
+}
+
+func (c *Client) metaGet(ctx context.Context, key string, flags []MetaFlag) (*MetaResult, error) {
+	return c.metaCommand(ctx, "mg", key, nil, flags)
+}
+
+// MetaSet stores an item using the ms command.
+// The item's expiration and flags are sent along with the given flags.
+func (c *Client) MetaSet(item *Item, flags ...MetaFlag) (*MetaResult, error) {
+	return c.metaSet(context.Background(), item, flags)
+}
+
+// MetaSetContext is like MetaSet but honours the deadline and cancellation of ctx.
+func (c *Client) MetaSetContext(ctx context.Context, item *Item, flags ...MetaFlag) (*MetaResult, error) {
+	return c.metaSet(ctx, item, flags)
+}
+
+func (c *Client) metaSet(ctx context.Context, item *Item, flags []MetaFlag) (*MetaResult, error) {
+	flags = append([]MetaFlag{
+		MetaTTL(item.Expiration),
+		MetaClientFlags(item.Flags),
+	}, flags...)
+
+	value := item.Value
+	if value == nil {
+		value = []byte{}
+	}
+
+	return c.metaCommand(ctx, "ms", item.Key, value, flags)
+}
+
+// MetaDelete removes or invalidates an item using the md command.
+func (c *Client) MetaDelete(key string, flags ...MetaFlag) (*MetaResult, error) {
+	return c.metaDelete(context.Background(), key, flags)
+}
+
+// MetaDeleteContext is like MetaDelete but honours the deadline and cancellation of ctx.
+func (c *Client) MetaDeleteContext(ctx context.Context, key string, flags ...MetaFlag) (*MetaResult, error) {
+	return c.metaDelete(ctx, key, flags)
+}
+
+func (c *Client) metaDelete(ctx context.Context, key string, flags []MetaFlag) (*MetaResult, error) {
+	return c.metaCommand(ctx, "md", key, nil, flags)
+}
+
+// MetaArithmetic increments or decrements a numerical value using the ma command.
+func (c *Client) MetaArithmetic(key string, flags ...MetaFlag) (*MetaResult, error) {
+	return c.metaArithmetic(context.Background(), key, flags)
+}
+
+// MetaArithmeticContext is like MetaArithmetic but honours the deadline and cancellation of ctx.
+func (c *Client) MetaArithmeticContext(ctx context.Context, key string, flags ...MetaFlag) (*MetaResult, error) {
+	return c.metaArithmetic(ctx, key, flags)
+}
+
+func (c *Client) metaArithmetic(ctx context.Context, key string, flags []MetaFlag) (*MetaResult, error) {
+	return c.metaCommand(ctx, "ma", key, nil, flags)
+}
+
+// MetaNoop sends the mn command to every server and waits for the reply.
+func (c *Client) MetaNoop() error {
+	return c.metaNoop(context.Background())
+}
+
+// MetaNoopContext is like MetaNoop but honours the deadline and cancellation of ctx.
+func (c *Client) MetaNoopContext(ctx context.Context) error {
+	return c.metaNoop(ctx)
+}
+
+func (c *Client) metaNoop(ctx context.Context) error {
+	if !c.supportsMeta() {
+		return ErrNotSupported
+	}
+
+	return c.router.Each(func(addr net.Addr) error {
+		cn, err := c.getFreeConn(ctx, addr.String())
+		if err != nil {
+			return err
+		}
+
+		line, err := writeFlushRead(cn, "mn\r\n")
+		if err == nil && !bytes.Equal(line, []byte("MN\r\n")) {
+			err = parseErrorLine(line)
+		}
+		c.putBackConnection(cn, err)
+
+		return cn.wrapError("mn", err)
+	})
+}
+
+// MetaDebug returns the internal details of an item using the me command.
+func (c *Client) MetaDebug(key string, flags ...MetaFlag) (map[string]string, error) {
+	return c.metaDebug(context.Background(), key, flags)
+}
+
+// MetaDebugContext is like MetaDebug but honours the deadline and cancellation of ctx.
+func (c *Client) MetaDebugContext(ctx context.Context, key string, flags ...MetaFlag) (map[string]string, error) {
+	return c.metaDebug(ctx, key, flags)
+}
+
+func (c *Client) metaDebug(ctx context.Context, key string, flags []MetaFlag) (map[string]string, error) {
+	if !c.supportsMeta() {
+		return nil, ErrNotSupported
+	}
+
+	flags = c.metaFlags(flags)
+	skey, wireKey, err := c.metaKey(key, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	cn, err := c.createReadWriter(ctx, skey)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := metaDebugFn(cn, wireKey, flags)
+	c.putBackConnection(cn, err)
+
+	return res, cn.wrapError("me", err)
+}
+
+func metaDebugFn(cn *Connection, key string, flags []MetaFlag) (map[string]string, error) {
+	line, err := writeFlushRead(cn, buildMetaCommand("me", key, nil, flags))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseMetaDebug(line)
+}
+
+func (c *Client) metaCommand(ctx context.Context, verb, key string, value []byte, flags []MetaFlag) (*MetaResult, error) {
+	if !c.supportsMeta() {
+		return nil, ErrNotSupported
+	}
+
+	if verb != "mg" {
+		defer c.near.invalidate(key)
+	}
+
+	flags = c.metaFlags(flags)
+	skey, wireKey, err := c.metaKey(key, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	cn, err := c.createReadWriter(ctx, skey)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.metaFn(verb, cn, wireKey, value, flags)
+	if err == nil && res.Key != "" {
+		res.Key = key
+	}
+
+	return res, err
+}
+
+func (c *Client) metaFn(verb string, cn *Connection, key string, value []byte, flags []MetaFlag) (*MetaResult, error) {
+	res, err := metaRoundTrip(cn, verb, key, value, flags)
+	c.putBackConnection(cn, err)
+
+	return res, cn.wrapError(verb, err)
+}
+
+func metaRoundTrip(cn *Connection, verb string, key string, value []byte, flags []MetaFlag) (*MetaResult, error) {
+	quiet := hasMetaFlag(flags, MetaQuiet.token)
+
+	if err := writeMetaCommand(cn.rw, verb, key, value, flags); err != nil {
+		return nil, err
+	}
+
+	// In quiet mode the server does not reply on success,
+	// so we need a noop to know when the command is done.
+	if quiet {
+		if _, err := fmt.Fprint(cn.rw, "mn\r\n"); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cn.flush(); err != nil {
+		return nil, err
+	}
+
+	res, err := parseMetaResponse(cn.rw)
+	if quiet && res != nil && res.Status == "MN" {
+		if verb == "mg" {
+			return nil, ErrCacheMiss
+		}
+		return &MetaResult{Status: "HD"}, nil
+	}
+
+	// The reply was not suppressed, so the noop reply still has to be read.
+	if quiet {
+		if _, rerr := cn.rw.ReadSlice('\n'); rerr != nil {
+			return nil, rerr
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if hasMetaFlag(flags, MetaBase64Key.token) && res.Key != "" {
+		k, err := base64.StdEncoding.DecodeString(res.Key)
+		if err != nil {
+			return nil, err
+		}
+		res.Key = string(k)
+	}
+
+	return res, nil
+}
+
+// supportsMeta reports whether the meta commands can be sent,
+// they are only available with the text protocol.
+func (c *Client) supportsMeta() bool {
+	switch c.protocol.(type) {
+	case textProtocol, metaProtocol:
+		return true
+	default:
+		return false
+	}
+}
+
+// metaKey returns the server key and the key sent over the wire,
+// which is encoded when the base64 flag is given.
+func (c *Client) metaKey(key string, flags []MetaFlag) (string, string, error) {
+	if hasMetaFlag(flags, MetaBase64Key.token) {
+		skey := c.keyPrefix + key
+		if c.hashKeys && (len(skey) > 250 || strings.HasPrefix(key, hashMarker)) {
+			skey = c.hashedKey(key)
+		}
+
+		if len(key) == 0 || len(skey) > 250 {
+			return "", "", ErrMalformedKey
+		}
+		return skey, base64.StdEncoding.EncodeToString([]byte(skey)), nil
+	}
+
+	skey, err := c.serverKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	return skey, skey, nil
+}
+
+// metaFlags adds the base64 flag with WithBinaryKeys,
+// so keys with any bytes can be sent.
+func (c *Client) metaFlags(flags []MetaFlag) []MetaFlag {
+	if !c.binaryKeys || hasMetaFlag(flags, MetaBase64Key.token) {
+		return flags
+	}
+
+	return append(flags[:len(flags):len(flags)], MetaBase64Key)
+}
+
+func hasMetaFlag(flags []MetaFlag, token byte) bool {
+	for _, f := range flags {
+		if f.token == token {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeMetaCommand(rw *bufio.ReadWriter, verb, key string, value []byte, flags []MetaFlag) error {
+	if _, err := fmt.Fprint(rw, buildMetaCommand(verb, key, value, flags)); err != nil {
+		return err
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	if _, err := rw.Write(value); err != nil {
+		return err
+	}
+	_, err := rw.Write([]byte("\r\n"))
+
+	return err
+}
+
+func buildMetaCommand(verb, key string, value []byte, flags []MetaFlag) string {
+	var sb strings.Builder
+
+	sb.WriteString(verb)
+	sb.WriteByte(' ')
+	sb.WriteString(key)
+
+	if value != nil {
+		sb.WriteByte(' ')
+		sb.WriteString(strconv.Itoa(len(value)))
+	}
+
+	for _, f := range flags {
+		sb.WriteByte(' ')
+		sb.WriteString(f.String())
+	}
+
+	sb.WriteString("\r\n")
+
+	return sb.String()
+}
+
+func parseMetaResponse(rw *bufio.ReadWriter) (*MetaResult, error) {
+	line, err := rw.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimSpace(string(line))
+
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil, malformedResponse(text)
+	}
+
+	res := &MetaResult{Status: fields[0]}
+	tokens := fields[1:]
+
+	switch res.Status {
+	case "VA":
+		if len(tokens) == 0 {
+			return nil, malformedResponse(text)
+		}
+
+		size, err := strconv.Atoi(tokens[0])
+		if err != nil || size < 0 || size > maxValueSize {
+			return nil, malformedResponse(text)
+		}
+		tokens = tokens[1:]
+
+		// The data block is followed by CRLF.
+		res.Value = make([]byte, size+2)
+		if _, err := io.ReadFull(rw, res.Value); err != nil {
+			return nil, err
+		}
+
+		if !bytes.HasSuffix(res.Value, []byte("\r\n")) {
+			return nil, malformedResponse("data block is not terminated by CRLF")
+		}
+		res.Value = res.Value[:size]
+	case "HD", "MN":
+	case "EN", "NF":
+		err = ErrCacheMiss
+	case "NS":
+		err = ErrNotStored
+	case "EX":
+		err = ErrExists
+	default:
+		return nil, parseErrorLine(line)
+	}
+
+	// The failures carry the flags too, e.g. the opaque token.
+	if perr := parseMetaFlags(res, tokens); perr != nil {
+		return nil, malformedResponse(text)
+	}
+
+	return res, err
+}
+
+func parseMetaFlags(res *MetaResult, tokens []string) error {
+	for _, tok := range tokens {
+		arg := tok[1:]
+
+		switch tok[0] {
+		case 'c':
+			cas, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return err
+			}
+			res.CAS = cas
+		case 'f':
+			flags, err := strconv.ParseUint(arg, 10, 32)
+			if err != nil {
+				return err
+			}
+			res.Flags = int32(flags)
+		case 'h':
+			res.HitBefore = arg == "1"
+		case 'k':
+			res.Key = arg
+		case 'l':
+			secs, err := strconv.Atoi(arg)
+			if err != nil {
+				return err
+			}
+			res.LastAccess = time.Duration(secs) * time.Second
+		case 'O':
+			res.Opaque = arg
+		case 's':
+			size, err := strconv.Atoi(arg)
+			if err != nil {
+				return err
+			}
+			res.Size = size
+		case 't':
+			secs, err := strconv.Atoi(arg)
+			if err != nil {
+				return err
+			}
+			if secs < 0 {
+				res.TTL = -1
+			} else {
+				res.TTL = time.Duration(secs) * time.Second
+			}
+		case 'W':
+			res.Win = true
+		case 'X':
+			res.Stale = true
+		case 'Z':
+			res.AlreadyWon = true
+		}
+	}
+
+	return nil
+}
+
+func parseMetaDebug(line []byte) (map[string]string, error) {
+	if bytes.Equal(line, []byte("EN\r\n")) {
+		return nil, ErrCacheMiss
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) < 2 || fields[0] != "ME" {
+		return nil, parseErrorLine(line)
+	}
+
+	res := make(map[string]string, len(fields)-2)
+	for _, f := range fields[2:] {
+		k, v, _ := strings.Cut(f, "=")
+		res[k] = v
+	}
+
+	return res, nil
+}
@@ -0,0 +1,126 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache Meta Commands Tests", Label("MetaCommands"), func() {
+	var mc *Client
+	var metaIt *Item
+	var counterIt *Item
+
+	BeforeEach(func() {
+		mc = New([]string{defaultAddr}, 1)
+
+		metaIt = &Item{
+			Key:        "meta_key",
+			Value:      []byte("meta value"),
+			Expiration: time.Second * 60,
+			Flags:      42,
+		}
+		counterIt = &Item{
+			Key:        "meta_counter",
+			Value:      []byte("5"),
+			Expiration: time.Second * 60,
+		}
+	})
+
+	AfterEach(func() {
+		mc.Close()
+	})
+
+	It("Meta commands with a working client", func() {
+		By("Noop on every server")
+		Expect(mc.MetaNoop()).To(Succeed())
+
+		By("Meta get on a key that doesn't exist")
+		_, err := mc.MetaGet("meta_missing", MetaReturnValue)
+		Expect(err).To(MatchError(ErrCacheMiss))
+
+		By("Meta get after a meta set returns the value, flags and TTL")
+		res, err := mc.MetaSet(metaIt, MetaReturnCAS)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Status).To(Equal("HD"))
+		Expect(res.CAS).ToNot(BeZero())
+
+		res, err = mc.MetaGet(metaIt.Key, MetaReturnValue, MetaReturnFlags,
+			MetaReturnTTL, MetaReturnKey, MetaOpaque("123"), MetaReturnHit)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Status).To(Equal("VA"))
+		Expect(res.Value).To(Equal(metaIt.Value))
+		Expect(res.Flags).To(Equal(metaIt.Flags))
+		Expect(res.Key).To(Equal(metaIt.Key))
+		Expect(res.Opaque).To(Equal("123"))
+		Expect(res.HitBefore).To(BeFalse())
+		Expect(res.TTL).To(BeNumerically("~", time.Second*60, time.Second))
+
+		By("Meta set with a stale CAS value fails")
+		_, err = mc.MetaSet(metaIt, MetaCompareCAS(res.CAS+1000))
+		Expect(err).To(MatchError(ErrExists))
+
+		By("Meta add on an existing key is not stored")
+		_, err = mc.MetaSet(metaIt, MetaSetMode(MetaModeAdd))
+		Expect(err).To(MatchError(ErrNotStored))
+
+		By("Meta get in quiet mode on a key that doesn't exist")
+		_, err = mc.MetaGet("meta_missing", MetaReturnValue, MetaQuiet)
+		Expect(err).To(MatchError(ErrCacheMiss))
+
+		By("Meta debug returns the item details")
+		dbg, err := mc.MetaDebug(metaIt.Key)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dbg).To(HaveKey("exp"))
+
+		By("Meta set and get with a base64 encoded binary key")
+		binIt := &Item{Key: "bin key\r\n", Value: []byte("binary"), Expiration: time.Second * 60}
+		_, err = mc.MetaSet(binIt, MetaBase64Key)
+		Expect(err).ToNot(HaveOccurred())
+		res, err = mc.MetaGet(binIt.Key, MetaBase64Key, MetaReturnValue, MetaReturnKey)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Key).To(Equal(binIt.Key))
+		Expect(res.Value).To(Equal(binIt.Value))
+
+		By("Meta arithmetic increments and decrements a counter")
+		err = mc.Set(counterIt)
+		Expect(err).ToNot(HaveOccurred())
+		res, err = mc.MetaArithmetic(counterIt.Key, MetaDelta(10), MetaReturnValue)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(res.Value)).To(Equal("15"))
+		res, err = mc.MetaArithmetic(counterIt.Key, MetaSetMode(MetaModeDecr), MetaDelta(3), MetaReturnValue)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(res.Value)).To(Equal("12"))
+
+		By("Meta delete in quiet mode removes the key")
+		_, err = mc.MetaDelete(metaIt.Key, MetaQuiet)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = mc.MetaGet(metaIt.Key, MetaReturnValue)
+		Expect(err).To(MatchError(ErrCacheMiss))
+		_, err = mc.MetaDelete(metaIt.Key)
+		Expect(err).To(MatchError(ErrCacheMiss))
+	})
+})
@@ -0,0 +1,276 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// metaProtocol sends the commands working with keys as meta commands
+// with base64 encoded keys, so the keys can contain any bytes.
+// The other commands are sent like with the text protocol.
+type metaProtocol struct {
+	textProtocol
+}
+
+var metaModes = map[string]MetaMode{
+	"set":     MetaModeSet,
+	"add":     MetaModeAdd,
+	"replace": MetaModeReplace,
+	"append":  MetaModeAppend,
+	"prepend": MetaModePrepend,
+	"cas":     MetaModeSet,
+}
+
+func encodeKey(key string) string {
+	return base64.StdEncoding.EncodeToString([]byte(key))
+}
+
+// metaStoreFlags returns the flags of ms storing the item like the verb.
+// The key is sent as it is unless the caller adds MetaBase64Key.
+func metaStoreFlags(verb string, item *Item) []MetaFlag {
+	flags := []MetaFlag{
+		MetaTTL(item.Expiration),
+		MetaClientFlags(item.Flags),
+		MetaSetMode(metaModes[verb]),
+	}
+
+	if verb == "cas" {
+		flags = append(flags, MetaCompareCAS(item.CAS))
+	}
+
+	return flags
+}
+
+func metaRetrieveFlags(verb string, ttl time.Duration) []MetaFlag {
+	flags := []MetaFlag{MetaBase64Key, MetaReturnValue, MetaReturnFlags}
+
+	if verb == "gets" || verb == "gats" {
+		flags = append(flags, MetaReturnCAS)
+	}
+
+	if verb == "gat" || verb == "gats" {
+		flags = append(flags, MetaTTL(ttl))
+	}
+
+	return flags
+}
+
+func metaStoreValue(item *Item) []byte {
+	if item.Value == nil {
+		return []byte{}
+	}
+
+	return item.Value
+}
+
+func (metaProtocol) store(cn *Connection, verb string, item *Item) error {
+	_, err := metaRoundTrip(cn, "ms", encodeKey(item.Key), metaStoreValue(item), append(metaStoreFlags(verb, item), MetaBase64Key))
+	return err
+}
+
+func (metaProtocol) retrieve(cn *Connection, verb string, key string, ttl time.Duration) (*Item, error) {
+	res, err := metaRoundTrip(cn, "mg", encodeKey(key), nil, metaRetrieveFlags(verb, ttl))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Item{Key: key, Value: res.Value, Flags: res.Flags, CAS: res.CAS}, nil
+}
+
+func (metaProtocol) retrieveMulti(cn *Connection, verb string, keys []string, ttl time.Duration) (map[string]*Item, error) {
+	flags := metaRetrieveFlags(verb, ttl)
+
+	// Only the hits are answered in the quiet mode.
+	results, _, err := quietPipeline(cn, len(keys), func(i int, quiet ...MetaFlag) error {
+		return writeMetaCommand(cn.rw, "mg", encodeKey(keys[i]), nil, append(quiet, flags...))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	items := make(map[string]*Item, len(results))
+	for i, res := range results {
+		items[keys[i]] = &Item{Key: keys[i], Value: res.Value, Flags: res.Flags, CAS: res.CAS}
+	}
+
+	return items, nil
+}
+
+func (metaProtocol) delete(cn *Connection, key string) error {
+	_, err := metaRoundTrip(cn, "md", encodeKey(key), nil, []MetaFlag{MetaBase64Key})
+	return err
+}
+
+func (metaProtocol) touch(cn *Connection, key string, ttl time.Duration) error {
+	_, err := metaRoundTrip(cn, "mg", encodeKey(key), nil, []MetaFlag{MetaBase64Key, MetaTTL(ttl)})
+	return err
+}
+
+func (metaProtocol) storeMulti(cn *Connection, items []*Item) (map[int]error, error) {
+	return storeMultiQuiet(cn, items, encodeKey, MetaBase64Key)
+}
+
+// deleteMulti waits for the reply of every command, because the quiet mode
+// of md suppresses NF along with HD, so the missing keys would not be reported.
+func (metaProtocol) deleteMulti(cn *Connection, keys []string) (map[int]error, error) {
+	return pipeline(cn, len(keys), func(i int) error {
+		return writeMetaCommand(cn.rw, "md", encodeKey(keys[i]), nil, []MetaFlag{MetaBase64Key})
+	}, readMetaStatus)
+}
+
+func (metaProtocol) touchMulti(cn *Connection, keys []string, ttl time.Duration) (map[int]error, error) {
+	return touchMultiQuiet(cn, keys, ttl, encodeKey, MetaBase64Key)
+}
+
+func (metaProtocol) incrDecr(cn *Connection, verb string, key string, delta uint64) (uint64, error) {
+	mode := MetaModeIncr
+	if verb == "decr" {
+		mode = MetaModeDecr
+	}
+
+	res, err := metaRoundTrip(cn, "ma", encodeKey(key), nil, []MetaFlag{
+		MetaBase64Key,
+		MetaSetMode(mode),
+		MetaDelta(delta),
+		MetaReturnValue,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	val, err := strconv.ParseUint(string(res.Value), 10, 64)
+	if err != nil {
+		return 0, malformedResponse(string(res.Value))
+	}
+
+	return val, nil
+}
+
+func readMetaStatus(rw *bufio.ReadWriter) error {
+	_, err := parseMetaResponse(rw)
+	return err
+}
+
+// storeMultiQuiet sets the items with ms in the quiet mode,
+// so only the items which were not stored are answered. After an error
+// line every unanswered item fails with it, though some of them may
+// have been stored.
+func storeMultiQuiet(cn *Connection, items []*Item, key func(string) string, flags ...MetaFlag) (map[int]error, error) {
+	write := func(i int, quiet ...MetaFlag) error {
+		f := append(metaStoreFlags("set", items[i]), flags...)
+		return writeMetaCommand(cn.rw, "ms", key(items[i].Key), metaStoreValue(items[i]), append(f, quiet...))
+	}
+
+	_, errs, err := quietPipeline(cn, len(items), write)
+	if err != nil && resumableError(err) {
+		return errs, nil
+	}
+
+	return errs, err
+}
+
+// touchMultiQuiet touches the keys with mg in the quiet mode,
+// so only the keys which were found are answered.
+func touchMultiQuiet(cn *Connection, keys []string, ttl time.Duration, key func(string) string, flags ...MetaFlag) (map[int]error, error) {
+	write := func(i int, quiet ...MetaFlag) error {
+		return writeMetaCommand(cn.rw, "mg", key(keys[i]), nil, append(append(quiet, MetaTTL(ttl)), flags...))
+	}
+
+	results, errs, err := quietPipeline(cn, len(keys), write)
+	if err != nil && !resumableError(err) {
+		return nil, err
+	}
+
+	for i := range keys {
+		if _, ok := results[i]; !ok && errs[i] == nil {
+			errs[i] = ErrCacheMiss
+		}
+	}
+
+	return errs, nil
+}
+
+// quietPipeline sends n meta commands in the quiet mode with their index
+// as the opaque token and a noop after them, so the server answers only
+// the commands whose reply is not suppressed and the noop. The replies are
+// matched to the commands by the token and returned by the index along with
+// their errors. CLIENT_ERROR and SERVER_ERROR replies carry no token, so the
+// command they answer is not known. The first one is set as the error of
+// every command without a reply and returned once the noop was read.
+func quietPipeline(cn *Connection, n int, write func(i int, quiet ...MetaFlag) error) (map[int]*MetaResult, map[int]error, error) {
+	for i := 0; i < n; i++ {
+		if err := write(i, MetaQuiet, MetaOpaque(strconv.Itoa(i))); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if _, err := fmt.Fprint(cn.rw, "mn\r\n"); err != nil {
+		return nil, nil, err
+	}
+
+	if err := cn.flush(); err != nil {
+		return nil, nil, err
+	}
+
+	results := make(map[int]*MetaResult)
+	errs := make(map[int]error)
+
+	var lineErr error
+	for {
+		res, err := parseMetaResponse(cn.rw)
+		if !resumableError(err) {
+			return nil, nil, err
+		}
+
+		if res == nil {
+			lineErr = err
+			continue
+		}
+
+		if res.Status == "MN" {
+			if lineErr != nil {
+				for i := 0; i < n; i++ {
+					if _, ok := results[i]; !ok {
+						errs[i] = lineErr
+					}
+				}
+			}
+			return results, errs, lineErr
+		}
+
+		i, perr := strconv.Atoi(res.Opaque)
+		if perr != nil || i < 0 || i >= n {
+			return nil, nil, malformedResponse("meta response does not match the request")
+		}
+
+		results[i] = res
+		if err != nil {
+			errs[i] = err
+		}
+	}
+}
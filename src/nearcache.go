@@ -0,0 +1,187 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// nearEntryOverhead approximates the memory used by an entry
+// besides its key and value.
+const nearEntryOverhead = 128
+
+// nearCache is a local LRU cache of the items read by Get.
+// A nil nearCache caches nothing.
+type nearCache struct {
+	maxBytes int64
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	bytes int64
+	lru   *list.List
+	items map[string]*list.Element
+	// version changes with every invalidation, so the items read
+	// before a write do not get cached after it.
+	version uint64
+}
+
+type nearEntry struct {
+	item    Item
+	size    int64
+	expires time.Time
+}
+
+func newNearCache(maxBytes int64, ttl time.Duration) *nearCache {
+	return &nearCache{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		lru:      list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// get returns a copy of the cached item.
+func (n *nearCache) get(key string) (*Item, bool) {
+	if n == nil {
+		return nil, false
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	el, ok := n.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*nearEntry)
+	if time.Now().After(e.expires) {
+		n.remove(el)
+		return nil, false
+	}
+	n.lru.MoveToFront(el)
+
+	it := e.item
+	it.Value = append([]byte(nil), e.item.Value...)
+
+	return &it, true
+}
+
+// currentVersion is read before an item is fetched from the server.
+func (n *nearCache) currentVersion() uint64 {
+	if n == nil {
+		return 0
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.version
+}
+
+// add caches a copy of the item unless it was invalidated
+// since the version was read.
+func (n *nearCache) add(it *Item, version uint64) {
+	if n == nil {
+		return
+	}
+
+	size := int64(len(it.Key)+len(it.Value)) + nearEntryOverhead
+	if size > n.maxBytes {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.version != version {
+		return
+	}
+
+	if el, ok := n.items[it.Key]; ok {
+		n.remove(el)
+	}
+
+	e := &nearEntry{item: *it, size: size, expires: time.Now().Add(n.ttl)}
+	e.item.Value = append([]byte(nil), it.Value...)
+
+	n.items[it.Key] = n.lru.PushFront(e)
+	n.bytes += size
+
+	for n.bytes > n.maxBytes {
+		n.remove(n.lru.Back())
+	}
+}
+
+// invalidate removes the keys after they were modified.
+func (n *nearCache) invalidate(keys ...string) {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.version++
+	for _, key := range keys {
+		if el, ok := n.items[key]; ok {
+			n.remove(el)
+		}
+	}
+}
+
+// invalidateItems is like invalidate for the keys of the items.
+func (n *nearCache) invalidateItems(items []*Item) {
+	if n == nil {
+		return
+	}
+
+	keys := make([]string, len(items))
+	for i, it := range items {
+		keys[i] = it.Key
+	}
+	n.invalidate(keys...)
+}
+
+// clear removes all the items, e.g. after the servers were flushed.
+func (n *nearCache) clear() {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.version++
+	n.bytes = 0
+	n.lru.Init()
+	clear(n.items)
+}
+
+func (n *nearCache) remove(el *list.Element) {
+	e := n.lru.Remove(el).(*nearEntry)
+	delete(n.items, e.item.Key)
+	n.bytes -= e.size
+}
@@ -0,0 +1,179 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache Near Cache Tests", Label("NearCache"), func() {
+	var (
+		mc    *Client
+		other *Client
+	)
+
+	BeforeEach(func() {
+		mc = New([]string{defaultAddr}, 2, WithNearCache(500*time.Millisecond, 1<<20))
+		Expect(mc).ToNot(BeNil())
+
+		other = New([]string{defaultAddr}, 2)
+		Expect(other).ToNot(BeNil())
+	})
+
+	AfterEach(func() {
+		mc.Close()
+		other.Close()
+	})
+
+	It("Serves the cached items until they expire", func() {
+		Expect(mc.Set(&Item{Key: "near_ttl", Value: []byte("v1")})).To(Succeed())
+
+		it, err := mc.Get("near_ttl")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("v1")))
+
+		Expect(other.Set(&Item{Key: "near_ttl", Value: []byte("v2")})).To(Succeed())
+
+		it, err = mc.Get("near_ttl")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("v1")))
+
+		By("Modifying the returned item does not change the cache")
+		it.Value[0] = 'x'
+
+		it, err = mc.Get("near_ttl")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("v1")))
+
+		Eventually(func() []byte {
+			it, err := mc.Get("near_ttl")
+			Expect(err).ToNot(HaveOccurred())
+			return it.Value
+		}, time.Second, 50*time.Millisecond).Should(Equal([]byte("v2")))
+	})
+
+	It("Invalidates the items written by the client", func() {
+		Expect(mc.Set(&Item{Key: "near_write", Value: []byte("v1")})).To(Succeed())
+
+		_, err := mc.Get("near_write")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(mc.Set(&Item{Key: "near_write", Value: []byte("v2")})).To(Succeed())
+
+		it, err := mc.Get("near_write")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("v2")))
+
+		By("CompareAndSwap")
+		it, err = mc.Gets("near_write")
+		Expect(err).ToNot(HaveOccurred())
+
+		it.Value = []byte("v3")
+		Expect(mc.CompareAndSwap(it)).To(Succeed())
+
+		it, err = mc.Get("near_write")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("v3")))
+
+		By("Delete")
+		Expect(mc.Delete("near_write")).To(Succeed())
+
+		_, err = mc.Get("near_write")
+		Expect(err).To(MatchError(ErrCacheMiss))
+
+		By("SetMulti")
+		Expect(mc.Set(&Item{Key: "near_write", Value: []byte("v4")})).To(Succeed())
+		_, err = mc.Get("near_write")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(mc.SetMulti([]*Item{{Key: "near_write", Value: []byte("v5")}})).To(BeNil())
+
+		it, err = mc.Get("near_write")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("v5")))
+	})
+
+	It("GetMulti fetches only the keys missing from the cache", func() {
+		Expect(mc.Set(&Item{Key: "near_multi_1", Value: []byte("a")})).To(Succeed())
+		Expect(mc.Set(&Item{Key: "near_multi_2", Value: []byte("b")})).To(Succeed())
+
+		_, err := mc.Get("near_multi_1")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(other.Set(&Item{Key: "near_multi_1", Value: []byte("x")})).To(Succeed())
+		Expect(other.Set(&Item{Key: "near_multi_2", Value: []byte("y")})).To(Succeed())
+
+		items, err := mc.GetMulti([]string{"near_multi_1", "near_multi_2", "near_multi_3"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(items).To(HaveLen(2))
+		Expect(items["near_multi_1"].Value).To(Equal([]byte("a")))
+		Expect(items["near_multi_2"].Value).To(Equal([]byte("y")))
+
+		By("The fetched items are cached")
+		Expect(other.Set(&Item{Key: "near_multi_2", Value: []byte("z")})).To(Succeed())
+
+		it, err := mc.Get("near_multi_2")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("y")))
+	})
+
+	It("Evicts the least recently used items over the size cap", func() {
+		near := newNearCache(3*(nearEntryOverhead+10), time.Minute)
+
+		for _, key := range []string{"k1", "k2", "k3"} {
+			near.add(&Item{Key: key, Value: []byte("12345678")}, near.currentVersion())
+		}
+
+		_, ok := near.get("k1")
+		Expect(ok).To(BeTrue())
+
+		near.add(&Item{Key: "k4", Value: []byte("12345678")}, near.currentVersion())
+		Expect(near.bytes).To(BeNumerically("<=", near.maxBytes))
+
+		_, ok = near.get("k2")
+		Expect(ok).To(BeFalse())
+
+		for _, key := range []string{"k1", "k3", "k4"} {
+			_, ok = near.get(key)
+			Expect(ok).To(BeTrue())
+		}
+
+		By("Items read before an invalidation are not cached")
+		version := near.currentVersion()
+		near.invalidate("k5")
+		near.add(&Item{Key: "k5", Value: []byte("v")}, version)
+
+		_, ok = near.get("k5")
+		Expect(ok).To(BeFalse())
+
+		By("Items larger than the cap are not cached")
+		near.add(&Item{Key: "k6", Value: make([]byte, near.maxBytes)}, near.currentVersion())
+
+		_, ok = near.get("k6")
+		Expect(ok).To(BeFalse())
+		Expect(near.items).To(HaveLen(3))
+	})
+})
@@ -0,0 +1,241 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import "time"
+
+// WithProtocol selects the protocol used to talk to the servers.
+// The text protocol is used by default.
+func WithProtocol(p ProtocolType) Option {
+	return func(c *Client) {
+		switch p {
+		case BinaryProtocol:
+			c.protocol = binaryProtocol{}
+		default:
+			c.protocol = textProtocol{}
+		}
+	}
+}
+
+// WithSASL authenticates every new connection with SASL PLAIN, which sends
+// the password in the clear. memcached supports SASL with the binary protocol
+// only, so it must be selected with WithProtocol, otherwise the connections
+// fail with ErrNotSupported. Rejected credentials fail with ErrAuthFailed.
+func WithSASL(username, password string) Option {
+	return func(c *Client) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// WithKetama distributes the keys over the servers with a ketama continuum
+// instead of the default modulo scheme. Servers missing from the weights
+// have a weight of one.
+func WithKetama(weights map[string]int) Option {
+	return func(c *Client) {
+		c.router = NewKetama(weights)
+	}
+}
+
+// WithServerSelector makes the client use the given selector to pick servers.
+// The addresses given to New are set on the selector if it has
+// a SetServers(addresses ...string) error method, e.g. the built-in
+// ServerList, Ketama, Rendezvous and JumpHash.
+func WithServerSelector(s ServerSelector) Option {
+	return func(c *Client) {
+		c.router = s
+	}
+}
+
+// WithTimeout sets the default deadline of every operation.
+// It is used when the context of the call has no earlier deadline.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithMaxOpenPerServer limits the number of open connections to each server.
+// Zero means there is no limit. It defaults to the connection count given to New.
+func WithMaxOpenPerServer(n int) Option {
+	return func(c *Client) {
+		c.maxOpen = n
+	}
+}
+
+// WithMaxIdlePerServer sets the number of idle connections kept for each server.
+// It defaults to the connection count given to New.
+func WithMaxIdlePerServer(n int) Option {
+	return func(c *Client) {
+		c.maxIdle = n
+	}
+}
+
+// WithPoolWaitTimeout limits how long an operation waits for a free connection
+// when all of them are in use. Zero means it waits until the context is done.
+func WithPoolWaitTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.poolWaitTimeout = timeout
+	}
+}
+
+// WithReconnectBackoff sets how long dialing a server is suspended after
+// it failed. The period starts at min and doubles with every failure up to max.
+func WithReconnectBackoff(min, max time.Duration) Option {
+	return func(c *Client) {
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+// WithPipelining makes concurrent operations share up to conns connections
+// to each server instead of taking a connection each. Requests are written
+// back-to-back and the responses are read in the order of the requests,
+// so a slow response delays the ones queued after it.
+// The connection limits of the pool do not apply.
+func WithPipelining(conns int) Option {
+	return func(c *Client) {
+		c.pipelineConns = conns
+	}
+}
+
+// WithCompression compresses the values of at least threshold bytes
+// stored by Set, Add, Replace, CompareAndSwap and SetMulti, and marks them
+// with FlagCompressed. The values read by the Get and GetAndTouch commands
+// are decompressed. Append, Prepend and the meta commands work with the
+// values as they are stored, so do not mix them with compressed items.
+// All the clients sharing the items have to use the same Compressor.
+func WithCompression(comp Compressor, threshold int) Option {
+	return func(c *Client) {
+		c.compressor = comp
+		c.compressMin = threshold
+	}
+}
+
+// WithKeyPrefix prepends the prefix to every key sent to the servers,
+// so clients with different prefixes do not see each other's items.
+// The items are returned with the keys given by the caller.
+func WithKeyPrefix(prefix string) Option {
+	return func(c *Client) {
+		c.keyPrefix = prefix
+	}
+}
+
+// WithKeyHashing replaces the keys which are too long or contain characters
+// the servers do not accept, e.g. URLs, with "sha1:" and the hex encoded
+// SHA-1 hash of the key after the prefix instead of rejecting them. The keys
+// starting with "sha1:" are hashed too, so they cannot collide.
+func WithKeyHashing() Option {
+	return func(c *Client) {
+		c.hashKeys = true
+	}
+}
+
+// WithBinaryKeys allows the keys to contain any bytes, only their length
+// is limited to 250 bytes. The binary protocol sends such keys as they are,
+// with the text protocol the commands are sent as meta commands with base64
+// encoded keys, which needs memcached 1.6 or newer.
+func WithBinaryKeys() Option {
+	return func(c *Client) {
+		c.binaryKeys = true
+	}
+}
+
+// WithLoadLease makes GetOrLoad add a lease key before running the loader,
+// so only one client of the cluster loads a key at a time. The others poll
+// the key every poll period until it is loaded. The lease expires after ttl
+// in case its holder fails, so ttl should be longer than the loader runs.
+func WithLoadLease(ttl, poll time.Duration) Option {
+	return func(c *Client) {
+		// The servers expire items with a granularity of a second
+		// and a zero expiration means the lease never expires.
+		c.leaseTTL = max(ttl, time.Second)
+		c.leasePoll = poll
+		if poll <= 0 {
+			c.leasePoll = defaultLeasePoll
+		}
+	}
+}
+
+// WithChunking splits the values which do not fit the item size limit
+// of the servers, 1MB when the limit is zero, into chunks stored under
+// their own keys. The item itself holds a manifest of the chunks marked
+// with FlagChunked and the Get and GetAndTouch commands reassemble the
+// value, a missing chunk is reported as a cache miss. Touch, Delete and the
+// meta commands only see the manifest, Append and Prepend must not be used
+// on chunked values. The chunks of replaced values are left to expire.
+func WithChunking(limit int) Option {
+	return func(c *Client) {
+		if limit <= 0 {
+			limit = defaultItemSizeLimit
+		}
+		c.chunkSize = max(limit-chunkHeadroom, 1)
+	}
+}
+
+// WithCodec sets the codec used by SetObject, JSONCodec by default.
+// The codecs given after it are registered for GetObject only, so
+// the items stored by other clients can be read while migrating.
+func WithCodec(codec Codec, readOnly ...Codec) Option {
+	return func(c *Client) {
+		c.codec = codec
+
+		if c.codecs == nil {
+			c.codecs = make(map[uint8]Codec)
+		}
+
+		for _, cd := range append(readOnly, codec) {
+			c.codecs[cd.ID()] = cd
+		}
+	}
+}
+
+// WithMarkDown marks a server down after the given number of consecutive
+// failed operations. Its keys fail fast with ErrServerDown, or go to another
+// server with WithFailover, and the server is probed with the version command
+// every period, at least 50ms, until it responds. It is disabled by default.
+func WithMarkDown(failures int, period time.Duration) Option {
+	return func(c *Client) {
+		c.markDownAfter = failures
+		c.deadTimeout = max(period, minProbePeriod)
+	}
+}
+
+// WithFailover sends the keys of the servers marked down to the next server
+// the selector picks, see FailoverSelector. The built-in selectors support it.
+func WithFailover() Option {
+	return func(c *Client) {
+		c.failover = true
+	}
+}
+
+// WithNearCache keeps the items read by Get and GetMulti in a local LRU
+// cache of up to maxBytes for ttl, so hot keys are served without a round
+// trip. The writes of this client, including the meta commands and FlushAll,
+// invalidate its cached items, but the writes of other clients are only seen
+// once the cached items expire, so ttl should be short.
+func WithNearCache(ttl time.Duration, maxBytes int64) Option {
+	return func(c *Client) {
+		c.near = newNearCache(maxBytes, ttl)
+	}
+}
@@ -0,0 +1,335 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sharedConn is a connection shared by concurrent operations when pipelining
+// is enabled. The operations write their requests one after another, the last
+// writer flushes the requests of all of them, and the responses are read in
+// the order the requests were written. Every operation can flush only once,
+// a second flush fails with errFlushedTwice.
+type sharedConn struct {
+	pool *connPool
+	conn net.Conn
+	rw   *bufio.ReadWriter
+
+	// writers counts the operations waiting to write or writing.
+	writers atomic.Int32
+	// wmu is held by the operation writing its request.
+	wmu sync.Mutex
+	// last is closed once the response to the last request was read.
+	last chan struct{}
+
+	// inflight and broken are guarded by the pool lock.
+	inflight int
+	broken   bool
+}
+
+// errFlushedTwice is returned when an operation on a shared connection
+// flushes again, its response was already queued with the first flush.
+var errFlushedTwice = errors.New("memcache: operation flushed a shared connection twice")
+
+var closedTurn = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// getShared returns an operation on the least busy shared connection.
+// A new connection is dialed while all of them are busy and the limit
+// is not reached.
+func (p *connPool) getShared(ctx context.Context) (*Connection, error) {
+	p.mu.Lock()
+	for len(p.shared) == 0 && p.dialing >= p.maxShared && !p.closed {
+		// Wait for the connections being dialed rather than
+		// opening more than maxShared of them.
+		dialed := p.dialed
+		p.mu.Unlock()
+
+		select {
+		case <-dialed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		p.mu.Lock()
+	}
+
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+
+	if p.down {
+		err := p.downError()
+		p.mu.Unlock()
+		return nil, err
+	}
+
+	var best *sharedConn
+	for _, s := range p.shared {
+		if best == nil || s.inflight < best.inflight {
+			best = s
+		}
+	}
+
+	full := len(p.shared)+p.dialing >= p.maxShared
+	if best != nil && (best.inflight == 0 || full || time.Now().Before(p.retryAt)) {
+		best.inflight++
+		p.mu.Unlock()
+		return best.begin(), nil
+	}
+
+	if time.Now().Before(p.retryAt) {
+		err := p.downError()
+		p.mu.Unlock()
+		return nil, err
+	}
+
+	if p.dialing == 0 {
+		p.dialed = make(chan struct{})
+	}
+	p.dialing++
+	p.mu.Unlock()
+
+	cn, err := p.dial(ctx)
+
+	p.mu.Lock()
+	p.dialing--
+	if p.dialing == 0 {
+		close(p.dialed)
+	}
+
+	if err != nil {
+		p.mu.Unlock()
+		if ctx.Err() == nil {
+			p.markFailure(err, true)
+		}
+		return nil, err
+	}
+
+	if p.closed {
+		p.mu.Unlock()
+		cn.conn.Close()
+		return nil, ErrPoolClosed
+	}
+
+	s := &sharedConn{
+		pool:     p,
+		conn:     cn.conn,
+		rw:       cn.rw,
+		last:     closedTurn,
+		inflight: 1,
+	}
+	p.shared = append(p.shared, s)
+	p.mu.Unlock()
+
+	return s.begin(), nil
+}
+
+// begin waits until the operation can write its request.
+func (s *sharedConn) begin() *Connection {
+	s.writers.Add(1)
+	s.wmu.Lock()
+
+	return &Connection{
+		pool:    s.pool,
+		conn:    s.conn,
+		rw:      s.rw,
+		shared:  s,
+		writing: true,
+	}
+}
+
+// flush queues the response of the operation after the earlier ones,
+// sends the requests unless another operation is about to write and
+// waits until it is the operation's turn to read. An operation which
+// gives up waiting breaks the connection.
+func (s *sharedConn) flush(cn *Connection) error {
+	if !cn.writing {
+		return errFlushedTwice
+	}
+
+	prev := s.last
+	cn.turn = make(chan struct{})
+	s.last = cn.turn
+
+	cn.writing = false
+	if err := s.endWrite(); err != nil {
+		return err
+	}
+
+	if err := cn.waitTurn(prev); err != nil {
+		// The earlier responses are left unread, the connection
+		// cannot be used by the operations queued after this one.
+		s.abandon()
+		return err
+	}
+
+	return cn.setReadContext()
+}
+
+// waitTurn waits until the response to the previous request was read
+// or the operation is cancelled or its deadline passes.
+func (cn *Connection) waitTurn(prev <-chan struct{}) error {
+	select {
+	case <-prev:
+		return nil
+	default:
+	}
+
+	var done <-chan struct{}
+	var ctxDeadline time.Time
+	if cn.ctx != nil {
+		done = cn.ctx.Done()
+		ctxDeadline, _ = cn.ctx.Deadline()
+	}
+
+	// The deadline of the context is reported by the context itself.
+	var expired <-chan time.Time
+	if !cn.deadline.IsZero() && !cn.deadline.Equal(ctxDeadline) {
+		timer := time.NewTimer(time.Until(cn.deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-prev:
+		return nil
+	case <-done:
+		return cn.ctx.Err()
+	case <-expired:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+// abandon marks the connection broken and closes it.
+func (s *sharedConn) abandon() {
+	p := s.pool
+
+	p.mu.Lock()
+	if !s.broken {
+		s.broken = true
+		p.removeShared(s)
+	}
+	p.mu.Unlock()
+
+	s.conn.Close()
+}
+
+func (s *sharedConn) endWrite() error {
+	var err error
+	if s.writers.Add(-1) == 0 {
+		err = s.rw.Flush()
+	}
+	s.wmu.Unlock()
+
+	return err
+}
+
+// release ends the operation. A connection which could be out of sync
+// is closed before the next operation reads from it.
+func (s *sharedConn) release(cn *Connection, err error, interrupted bool) {
+	if cn.writing {
+		cn.writing = false
+		if ferr := s.endWrite(); ferr != nil && err == nil {
+			err = ferr
+		}
+	}
+
+	p := s.pool
+	failed := false
+
+	p.mu.Lock()
+	s.inflight--
+
+	if !resumableError(err) {
+		if !s.broken {
+			s.broken = true
+			failed = !interrupted
+			p.removeShared(s)
+		}
+		s.conn.Close()
+	} else {
+		p.failures = 0
+		p.lastErr = nil
+	}
+
+	if p.closed && s.inflight == 0 {
+		s.conn.Close()
+	}
+	p.mu.Unlock()
+
+	if cn.turn != nil {
+		close(cn.turn)
+	}
+
+	if failed {
+		p.markFailure(err, false)
+	}
+}
+
+// removeShared forgets a broken connection, the pool lock must be held.
+func (p *connPool) removeShared(s *sharedConn) {
+	for i, other := range p.shared {
+		if other == s {
+			p.shared = append(p.shared[:i], p.shared[i+1:]...)
+			return
+		}
+	}
+}
+
+// flush sends the buffered request.
+func (cn *Connection) flush() error {
+	if cn.shared != nil {
+		return cn.shared.flush(cn)
+	}
+
+	return cn.rw.Flush()
+}
+
+// setReadContext applies the deadline and cancellation of the operation
+// to the shared connection while it reads its response.
+func (cn *Connection) setReadContext() error {
+	if err := cn.conn.SetReadDeadline(cn.deadline); err != nil {
+		return err
+	}
+
+	if cn.ctx != nil {
+		cn.stop = context.AfterFunc(cn.ctx, func() {
+			cn.conn.SetReadDeadline(time.Now())
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache Pipelining Tests", Label("Pipelining"), func() {
+	for _, proto := range []ProtocolType{TextProtocol, BinaryProtocol} {
+		proto := proto
+
+		It(fmt.Sprintf("Concurrent operations share the connections with protocol %d", proto), func() {
+			mc := New([]string{defaultAddr}, 1, WithProtocol(proto), WithPipelining(2))
+			Expect(mc).ToNot(BeNil())
+			defer mc.Close()
+
+			var wg sync.WaitGroup
+			for i := 0; i < 200; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					key := fmt.Sprintf("pipeline_%d_%d", proto, i)
+					value := []byte(fmt.Sprintf("value_%d", i))
+					Expect(mc.Set(&Item{Key: key, Value: value, Expiration: time.Minute})).To(Succeed())
+
+					it, err := mc.Get(key)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(it.Value).To(Equal(value))
+
+					_, err = mc.Get(key + "_missing")
+					Expect(err).To(MatchError(ErrCacheMiss))
+
+					items, err := mc.GetMulti([]string{key, key + "_missing"})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(items).To(HaveLen(1))
+				}(i)
+			}
+			wg.Wait()
+
+			p := mc.pools[defaultAddr]
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			Expect(len(p.shared)).To(BeNumerically("<=", 2))
+			Expect(p.idle).To(BeEmpty())
+			for _, s := range p.shared {
+				Expect(s.inflight).To(BeZero())
+			}
+		})
+	}
+
+	It("A broken shared connection fails the queued operations", func() {
+		garbage, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer garbage.Close()
+
+		go func() {
+			for {
+				conn, err := garbage.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					time.Sleep(20 * time.Millisecond)
+					conn.Write([]byte("GARBAGE\r\n"))
+				}()
+			}
+		}()
+
+		mc := New([]string{garbage.Addr().String()}, 1, WithPipelining(1), WithTimeout(time.Second))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				_, err := mc.Get("key")
+				Expect(err).To(HaveOccurred())
+			}()
+		}
+		wg.Wait()
+
+		p := mc.pools[garbage.Addr().String()]
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		Expect(p.shared).To(BeEmpty())
+	})
+
+	It("A hung server times out the queued operations", func() {
+		hung, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer hung.Close()
+
+		mc := New([]string{hung.Addr().String()}, 1, WithPipelining(1), WithTimeout(100*time.Millisecond))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				_, err := mc.Get("key")
+				Expect(err).To(HaveOccurred())
+			}()
+		}
+		wg.Wait()
+
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+
+	It("A queued operation gives up waiting for a hung request at its deadline", func() {
+		hung, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer hung.Close()
+
+		mc := New([]string{hung.Addr().String()}, 1, WithPipelining(1), WithTimeout(5*time.Second))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		first := make(chan error, 1)
+		go func() {
+			_, err := mc.Get("key")
+			first <- err
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err = mc.GetContext(ctx, "key")
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+
+		Eventually(first).Should(Receive(HaveOccurred()))
+
+		p := mc.pools[hung.Addr().String()]
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		Expect(p.shared).To(BeEmpty())
+	})
+
+	It("A second flush of one operation fails instead of corrupting the connection", func() {
+		mc := New([]string{defaultAddr}, 1, WithPipelining(1))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		cn, err := mc.pools[defaultAddr].getShared(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cn.setContext(context.Background(), time.Second)).To(Succeed())
+
+		_, err = cn.rw.WriteString("version\r\n")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cn.flush()).To(Succeed())
+
+		err = cn.flush()
+		Expect(err).To(MatchError(errFlushedTwice))
+		mc.putBackConnection(cn, err)
+
+		Expect(mc.Set(&Item{Key: "flushed_twice", Value: []byte("ok")})).To(Succeed())
+	})
+})
@@ -0,0 +1,420 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMinBackoff = 100 * time.Millisecond
+	defaultMaxBackoff = 10 * time.Second
+	// minProbePeriod keeps the probes of a server marked down from
+	// redialing it without a pause.
+	minProbePeriod = 50 * time.Millisecond
+)
+
+// connPool holds the connections to a single server.
+// Connections are dialed on demand and up to maxIdle of them
+// are kept around once they are put back.
+type connPool struct {
+	addr        net.Addr
+	maxIdle     int
+	waitTimeout time.Duration
+	dialTimeout time.Duration
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+
+	// The server is marked down after markDownAfter consecutive
+	// failures and probed every deadTimeout until it responds.
+	markDownAfter int
+	deadTimeout   time.Duration
+	protocol      protocol
+
+	// New connections are authenticated when username is set.
+	username string
+	password string
+
+	// slots limits the number of open connections,
+	// it is nil when the number is unlimited.
+	slots chan struct{}
+
+	// maxShared is the number of connections shared
+	// by the operations when pipelining is enabled.
+	maxShared int
+
+	mu      sync.Mutex
+	idle    []*Connection
+	shared  []*sharedConn
+	dialing int
+	// dialed is closed once no shared connection is being dialed.
+	dialed chan struct{}
+	closed bool
+	done   chan struct{}
+
+	// Health of the server, failures counts the consecutive
+	// failed operations and dialing is not retried until retryAt.
+	failures int
+	lastErr  error
+	retryAt  time.Time
+	down     bool
+}
+
+func (c *Client) newPool(addr net.Addr) *connPool {
+	p := &connPool{
+		addr:        addr,
+		maxIdle:     c.maxIdle,
+		waitTimeout: c.poolWaitTimeout,
+		dialTimeout: c.timeout,
+		minBackoff:  c.minBackoff,
+		maxBackoff:  c.maxBackoff,
+
+		markDownAfter: c.markDownAfter,
+		deadTimeout:   c.deadTimeout,
+		protocol:      c.protocol,
+		username:      c.username,
+		password:      c.password,
+		maxShared:     c.pipelineConns,
+		done:          make(chan struct{}),
+	}
+
+	if c.maxOpen > 0 {
+		p.slots = make(chan struct{}, c.maxOpen)
+	}
+
+	return p
+}
+
+// get returns an idle connection or dials a new one.
+// When the pool is exhausted it waits until a connection is put back,
+// the context is done or the wait timeout elapses.
+func (p *connPool) get(ctx context.Context) (*Connection, error) {
+	if p.maxShared > 0 {
+		return p.getShared(ctx)
+	}
+
+	if err := p.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.release()
+		return nil, ErrPoolClosed
+	}
+
+	// A server marked down fails fast until it answers a probe.
+	if p.down {
+		err := p.downError()
+		p.mu.Unlock()
+		p.release()
+		return nil, err
+	}
+
+	if n := len(p.idle); n > 0 {
+		cn := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return cn, nil
+	}
+
+	// Do not hammer a server we recently failed to reach.
+	if time.Now().Before(p.retryAt) {
+		err := p.downError()
+		p.mu.Unlock()
+		p.release()
+		return nil, err
+	}
+	p.mu.Unlock()
+
+	cn, err := p.dial(ctx)
+	if err != nil {
+		p.release()
+		if ctx.Err() == nil {
+			p.markFailure(err, true)
+		}
+		return nil, err
+	}
+
+	return cn, nil
+}
+
+// put returns the connection to the pool or closes it
+// if there are enough idle connections already.
+// It is only called after a successful operation.
+func (p *connPool) put(cn *Connection) {
+	p.mu.Lock()
+	p.failures = 0
+	p.lastErr = nil
+
+	if p.closed || len(p.idle) >= p.maxIdle {
+		p.mu.Unlock()
+		cn.conn.Close()
+	} else {
+		p.idle = append(p.idle, cn)
+		p.mu.Unlock()
+	}
+
+	p.release()
+}
+
+// discard closes a broken connection, a new one is dialed
+// on demand to replace it. Connections interrupted by the caller
+// are not counted as a failure of the server.
+func (p *connPool) discard(cn *Connection, err error, interrupted bool) {
+	cn.conn.Close()
+	p.release()
+
+	if !interrupted {
+		p.markFailure(err, false)
+	}
+}
+
+// markFailure records a failed operation. When backoff is set,
+// dialing is not retried for a period growing with every failure.
+func (p *connPool) markFailure(err error, backoff bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.failures++
+	p.lastErr = err
+
+	if backoff {
+		d := p.maxBackoff
+		if shift := p.failures - 1; shift < 32 && p.minBackoff<<shift < p.maxBackoff {
+			d = p.minBackoff << shift
+		}
+		p.retryAt = time.Now().Add(d)
+	}
+
+	if p.markDownAfter > 0 && p.failures >= p.markDownAfter && !p.down && !p.closed {
+		p.markDown()
+	}
+}
+
+// markDown stops sending operations to the server and starts probing it.
+// The pool lock must be held.
+func (p *connPool) markDown() {
+	p.down = true
+	p.retryAt = time.Now().Add(p.deadTimeout)
+
+	for _, cn := range p.idle {
+		cn.conn.Close()
+	}
+	p.idle = nil
+
+	go p.probe()
+}
+
+// probe sends the version command to the server every deadTimeout
+// and marks it up again once it responds.
+func (p *connPool) probe() {
+	t := time.NewTimer(p.deadTimeout)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-t.C:
+		}
+
+		err := p.ping()
+
+		p.mu.Lock()
+		if err == nil {
+			p.down = false
+			p.failures = 0
+			p.lastErr = nil
+			p.retryAt = time.Time{}
+			p.mu.Unlock()
+			return
+		}
+
+		p.lastErr = err
+		p.retryAt = time.Now().Add(p.deadTimeout)
+		p.mu.Unlock()
+
+		t.Reset(p.deadTimeout)
+	}
+}
+
+func (p *connPool) ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.deadTimeout)
+	defer cancel()
+
+	cn, err := p.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer cn.conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	if err := cn.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	_, err = p.protocol.version(cn)
+
+	return err
+}
+
+// downError reports the last failure of the server.
+// The pool lock must be held.
+func (p *connPool) downError() error {
+	e := &Error{Kind: ErrServerDown, Addr: p.addr.String()}
+	if p.lastErr != nil {
+		e.Msg = p.lastErr.Error()
+	}
+
+	return e
+}
+
+func (p *connPool) isDown() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.down
+}
+
+func (p *connPool) health() ServerHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return ServerHealth{
+		Healthy:   p.failures == 0,
+		Failures:  p.failures,
+		LastError: p.lastErr,
+		RetryAt:   p.retryAt,
+		Down:      p.down,
+		Idle:      len(p.idle),
+	}
+}
+
+// close closes the idle connections, the ones in use
+// are closed once they are put back.
+func (p *connPool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var retErr error
+
+	for _, cn := range p.idle {
+		if err := cn.conn.Close(); err != nil {
+			retErr = err
+		}
+	}
+
+	p.idle = nil
+
+	// The shared connections in use are closed once they are released.
+	for _, s := range p.shared {
+		if s.inflight == 0 {
+			if err := s.conn.Close(); err != nil {
+				retErr = err
+			}
+		}
+	}
+	p.shared = nil
+
+	if !p.closed {
+		p.closed = true
+		close(p.done)
+	}
+
+	return retErr
+}
+
+func (p *connPool) acquire(ctx context.Context) error {
+	if p.slots == nil {
+		return nil
+	}
+
+	// Fast path without allocating a timer.
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	var timeout <-chan time.Time
+	if p.waitTimeout > 0 {
+		t := time.NewTimer(p.waitTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeout:
+		return ErrPoolTimeout
+	}
+}
+
+func (p *connPool) release() {
+	if p.slots != nil {
+		<-p.slots
+	}
+}
+
+func (p *connPool) dial(ctx context.Context) (*Connection, error) {
+	d := net.Dialer{Timeout: p.dialTimeout}
+
+	conn, err := d.DialContext(ctx, p.addr.Network(), p.addr.String())
+	if err != nil {
+		return nil, err
+	}
+
+	cn := &Connection{
+		pool: p,
+		conn: conn,
+		rw:   bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
+	}
+
+	if p.username != "" {
+		if err := p.auth(ctx, cn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return cn, nil
+}
+
+// auth authenticates a new connection within the dial timeout.
+func (p *connPool) auth(ctx context.Context, cn *Connection) error {
+	if err := cn.setContext(ctx, p.dialTimeout); err != nil {
+		return err
+	}
+	defer cn.clearContext()
+
+	return p.protocol.auth(cn, p.username, p.password)
+}
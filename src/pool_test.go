@@ -0,0 +1,177 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache Connection Pool Tests", Label("ConnectionPool"), func() {
+	It("Connections are dialed on demand up to the limit", func() {
+		mc := New([]string{defaultAddr}, 1, WithMaxOpenPerServer(4), WithMaxIdlePerServer(2))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		By("No connection is dialed before the first operation")
+		p := mc.pools[defaultAddr]
+		Expect(p.idle).To(BeEmpty())
+
+		By("Concurrent operations share at most the open connections")
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				key := fmt.Sprintf("pool_%d", i)
+				Expect(mc.Set(&Item{Key: key, Value: []byte("value"), Expiration: time.Minute})).To(Succeed())
+				it, err := mc.Get(key)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(it.Value).To(Equal([]byte("value")))
+			}(i)
+		}
+		wg.Wait()
+
+		By("Only the idle connections are kept")
+		Expect(len(p.idle)).To(BeNumerically("<=", 2))
+		Expect(p.slots).To(BeEmpty())
+	})
+
+	It("Waiting for a free connection times out", func() {
+		hung, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer hung.Close()
+
+		mc := New([]string{hung.Addr().String()}, 1,
+			WithTimeout(500*time.Millisecond), WithPoolWaitTimeout(50*time.Millisecond))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		go mc.Get("hello")
+		time.Sleep(50 * time.Millisecond)
+
+		_, err = mc.Get("hello")
+		Expect(err).To(MatchError(ErrPoolTimeout))
+	})
+
+	It("Operations fail once the client is closed", func() {
+		mc := New([]string{defaultAddr}, 1)
+		Expect(mc).ToNot(BeNil())
+		Expect(mc.Close()).To(Succeed())
+
+		_, err := mc.Get("hello")
+		Expect(err).To(MatchError(ErrPoolClosed))
+	})
+	It("Broken connections are discarded and redialed", func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+
+		// A server which replies to every command with garbage.
+		accepted := make(chan struct{}, 16)
+		go func() {
+			for {
+				nc, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				accepted <- struct{}{}
+
+				go func() {
+					defer nc.Close()
+					buf := make([]byte, 1024)
+					for {
+						if _, err := nc.Read(buf); err != nil {
+							return
+						}
+						nc.Write([]byte("GARBAGE\r\n"))
+					}
+				}()
+			}
+		}()
+
+		mc := New([]string{ln.Addr().String()}, 1)
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		_, err = mc.Get("hello")
+		Expect(err).To(HaveOccurred())
+		_, err = mc.Get("hello")
+		Expect(err).To(HaveOccurred())
+
+		health := mc.Health()[ln.Addr().String()]
+		Expect(health.Healthy).To(BeFalse())
+		Expect(health.Failures).To(Equal(2))
+		Expect(health.Idle).To(BeZero())
+		Expect(accepted).To(HaveLen(2))
+	})
+
+	It("Dialing a failed server is backed off", func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		addr := ln.Addr().String()
+		ln.Close()
+
+		mc := New([]string{addr}, 1, WithReconnectBackoff(200*time.Millisecond, time.Second))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		By("The first failure dials the server")
+		_, err = mc.Get("hello")
+		Expect(err).To(HaveOccurred())
+		Expect(err).ToNot(MatchError(ErrServerDown))
+
+		By("The following operations fail fast")
+		_, err = mc.Get("hello")
+		Expect(err).To(MatchError(ErrServerDown))
+		Expect(mc.Health()[addr].RetryAt).To(BeTemporally(">", time.Now()))
+
+		By("The server is dialed again once it is back")
+		ln, err = net.Listen("tcp", addr)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		go func() {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer nc.Close()
+			buf := make([]byte, 1024)
+			nc.Read(buf)
+			nc.Write([]byte("END\r\n"))
+		}()
+
+		Eventually(func() error {
+			_, err := mc.Get("hello")
+			return err
+		}).WithPolling(50 * time.Millisecond).Should(MatchError(ErrCacheMiss))
+		Expect(mc.Health()[addr].Healthy).To(BeTrue())
+	})
+})
@@ -0,0 +1,183 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// FlagXFetch is the bit of Item.Flags which marks the values stored
+// along with their expiration by GetOrRefresh on servers without
+// the meta commands.
+const FlagXFetch int32 = 1 << 28
+
+// xfetchHeader is the size of the expiration and the time
+// it took to load the value, stored before the value.
+const xfetchHeader = 16
+
+// xfetchBeta above one favours earlier refreshes.
+const xfetchBeta = 1.0
+
+// GetOrRefresh is like GetOrLoad, but it also refreshes the value before
+// it expires. While exactly one caller runs the loader the others are
+// served the current value, so hot keys never miss.
+//
+// With the meta commands the server picks the caller which refreshes the
+// value once its remaining TTL drops below a tenth of ttl, or once it was
+// marked stale with MetaDelete and MetaInvalidate. Without them, e.g. with
+// the binary protocol or servers older than memcached 1.6, the value is
+// stored with its expiration and every caller refreshes it early with
+// a probability growing as the expiration approaches, the XFetch algorithm.
+// If the refresh fails, the current value is returned.
+func (c *Client) GetOrRefresh(ctx context.Context, key string, ttl time.Duration, loader func() ([]byte, error)) ([]byte, error) {
+	if c.supportsMeta() && !c.noMetaGet.Load() {
+		value, err := c.refreshMeta(ctx, key, ttl, loader)
+		if !errors.Is(err, ErrError) {
+			return value, err
+		}
+
+		// The server does not know mg, XFetch is used from now on.
+		c.noMetaGet.Store(true)
+	}
+
+	return c.refreshXFetch(ctx, key, ttl, loader)
+}
+
+func (c *Client) refreshMeta(ctx context.Context, key string, ttl time.Duration, loader func() ([]byte, error)) ([]byte, error) {
+	res, err := c.metaGet(ctx, key, []MetaFlag{
+		MetaReturnValue,
+		MetaReturnFlags,
+		MetaReturnCAS,
+		MetaRecache(max(ttl/10, time.Second)),
+	})
+	if errors.Is(err, ErrCacheMiss) {
+		return c.loadOnce(ctx, key, ttl, loader, false)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := c.unpack(ctx, "get", &Item{Key: key, Value: res.Value, Flags: res.Flags}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if !res.Win {
+		return it.Value, nil
+	}
+
+	value, err := c.flights.do(ctx, key, func() ([]byte, error) {
+		value, err := loader()
+		if err != nil {
+			return nil, err
+		}
+
+		// The CAS value was read after the item was marked stale,
+		// so only a newer value stored meanwhile fails the swap.
+		c.compareAndSwap(context.WithoutCancel(ctx), &Item{Key: key, Value: value, Expiration: ttl, CAS: res.CAS})
+
+		return value, nil
+	})
+	if err != nil {
+		return it.Value, nil
+	}
+
+	return value, nil
+}
+
+func (c *Client) refreshXFetch(ctx context.Context, key string, ttl time.Duration, loader func() ([]byte, error)) ([]byte, error) {
+	it, err := c.get(ctx, key)
+	if errors.Is(err, ErrCacheMiss) {
+		return c.loadOnce(ctx, key, ttl, loader, true)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	value, expiry, delta, ok := decodeXFetch(it)
+	if !ok || expiry.IsZero() {
+		return value, nil
+	}
+
+	// The value is refreshed when now - delta * beta * ln(rand) >= expiry.
+	early := time.Duration(float64(delta) * xfetchBeta * -math.Log(1-rand.Float64()))
+	if time.Now().Add(early).Before(expiry) {
+		return value, nil
+	}
+
+	// The callers drawing a refresh while another one
+	// is running are served the current value.
+	fresh, started, err := c.flights.doIdle(ctx, key, func() ([]byte, error) {
+		return c.load(ctx, key, ttl, loader, true)
+	})
+	if !started || err != nil {
+		return value, nil
+	}
+
+	return fresh, nil
+}
+
+// encodeXFetch prepends the expiration of the value
+// and the time it took to load it.
+func encodeXFetch(value []byte, ttl, delta time.Duration) []byte {
+	var expiry int64
+	if ttl > 0 {
+		expiry = time.Now().Add(ttl).UnixMilli()
+	}
+
+	buf := make([]byte, xfetchHeader, xfetchHeader+len(value))
+	binary.BigEndian.PutUint64(buf, uint64(expiry))
+	binary.BigEndian.PutUint64(buf[8:], uint64(delta.Microseconds()))
+
+	return append(buf, value...)
+}
+
+// decodeXFetch splits the value stored by encodeXFetch,
+// other values are returned as they are.
+func decodeXFetch(it *Item) ([]byte, time.Time, time.Duration, bool) {
+	if it.Flags&FlagXFetch == 0 || len(it.Value) < xfetchHeader {
+		return it.Value, time.Time{}, 0, false
+	}
+
+	var expiry time.Time
+	if ms := int64(binary.BigEndian.Uint64(it.Value)); ms != 0 {
+		expiry = time.UnixMilli(ms)
+	}
+	delta := time.Duration(binary.BigEndian.Uint64(it.Value[8:])) * time.Microsecond
+
+	return it.Value[xfetchHeader:], expiry, delta, true
+}
+
+// itemValue returns the value without the expiration
+// stored by GetOrRefresh.
+func itemValue(it *Item) []byte {
+	value, _, _, _ := decodeXFetch(it)
+	return value
+}
@@ -0,0 +1,302 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// refreshAll calls GetOrRefresh concurrently and returns the values.
+func refreshAll(mc *Client, key string, ttl time.Duration, loader func() ([]byte, error)) []string {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		values []string
+	)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer GinkgoRecover()
+			defer wg.Done()
+
+			value, err := mc.GetOrRefresh(context.Background(), key, ttl, loader)
+			Expect(err).ToNot(HaveOccurred())
+
+			mu.Lock()
+			values = append(values, string(value))
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return values
+}
+
+// oldServer forwards the commands to addr but answers the meta
+// commands with ERROR, like memcached older than 1.6 does.
+func oldServer(addr string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			backend, err := net.Dial("tcp", addr)
+			if err != nil {
+				conn.Close()
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				defer backend.Close()
+				go io.Copy(conn, backend)
+
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+
+					if strings.HasPrefix(line, "m") {
+						conn.Write([]byte("ERROR\r\n"))
+						continue
+					}
+					backend.Write([]byte(line))
+				}
+			}()
+		}
+	}()
+
+	return l
+}
+
+var _ = Describe("Memcache GetOrRefresh Tests", Label("GetOrRefresh"), func() {
+	var loads atomic.Int32
+	var version atomic.Int32
+
+	loader := func() ([]byte, error) {
+		loads.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		return []byte{byte('0' + version.Load())}, nil
+	}
+
+	BeforeEach(func() {
+		loads.Store(0)
+		version.Store(1)
+	})
+
+	Context("With the meta commands", func() {
+		var mc *Client
+
+		BeforeEach(func() {
+			mc = New([]string{defaultAddr}, 4)
+			Expect(mc).ToNot(BeNil())
+		})
+
+		AfterEach(func() {
+			mc.Close()
+		})
+
+		It("A stale value is served while one caller refreshes it", func() {
+			Expect(refreshAll(mc, "refresh_stale", time.Minute, loader)).To(HaveEach("1"))
+			Expect(loads.Load()).To(Equal(int32(1)))
+
+			_, err := mc.MetaDelete("refresh_stale", MetaInvalidate, MetaTTL(time.Minute))
+			Expect(err).ToNot(HaveOccurred())
+
+			version.Store(2)
+			values := refreshAll(mc, "refresh_stale", time.Minute, loader)
+			Expect(loads.Load()).To(Equal(int32(2)))
+			Expect(values).To(ContainElement("2"))
+			Expect(values).To(ContainElement("1"))
+
+			value, err := mc.GetOrRefresh(context.Background(), "refresh_stale", time.Minute, loader)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal([]byte("2")))
+
+			res, err := mc.MetaGet("refresh_stale", MetaReturnTTL)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.Stale).To(BeFalse())
+			Expect(res.TTL).To(BeNumerically(">", 50*time.Second))
+		})
+
+		It("A value is refreshed before it expires", func() {
+			Expect(refreshAll(mc, "refresh_early", 2*time.Second, loader)).To(HaveEach("1"))
+			time.Sleep(1600 * time.Millisecond)
+
+			version.Store(2)
+			values := refreshAll(mc, "refresh_early", 2*time.Second, loader)
+			Expect(loads.Load()).To(Equal(int32(2)))
+			Expect(values).To(ContainElement("2"))
+			Expect(values).To(ContainElement("1"))
+		})
+
+		It("A failed refresh serves the current value", func() {
+			Expect(refreshAll(mc, "refresh_failed", time.Minute, loader)).To(HaveEach("1"))
+			_, err := mc.MetaDelete("refresh_failed", MetaInvalidate, MetaTTL(time.Minute))
+			Expect(err).ToNot(HaveOccurred())
+
+			value, err := mc.GetOrRefresh(context.Background(), "refresh_failed", time.Minute, func() ([]byte, error) {
+				return nil, errors.New("database is down")
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal([]byte("1")))
+		})
+	})
+
+	Context("Without the meta commands", func() {
+		var mc *Client
+
+		BeforeEach(func() {
+			mc = New([]string{defaultAddr}, 4, WithProtocol(BinaryProtocol))
+			Expect(mc).ToNot(BeNil())
+		})
+
+		AfterEach(func() {
+			mc.Close()
+		})
+
+		It("The value is stored with its expiration", func() {
+			Expect(refreshAll(mc, "xfetch_load", time.Minute, loader)).To(HaveEach("1"))
+			Expect(loads.Load()).To(Equal(int32(1)))
+
+			it, err := mc.Get("xfetch_load")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(it.Flags).To(Equal(FlagXFetch))
+
+			value, expiry, delta, ok := decodeXFetch(it)
+			Expect(ok).To(BeTrue())
+			Expect(value).To(Equal([]byte("1")))
+			Expect(expiry).To(BeTemporally("~", time.Now().Add(time.Minute), time.Second))
+			Expect(delta).To(BeNumerically(">=", 100*time.Millisecond))
+
+			By("GetOrLoad reads the value as well")
+			value, err = mc.GetOrLoad(context.Background(), "xfetch_load", time.Minute, loader)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal([]byte("1")))
+			Expect(loads.Load()).To(Equal(int32(1)))
+		})
+
+		It("A value about to expire is refreshed early", func() {
+			expiring := &Item{
+				Key:        "xfetch_early",
+				Value:      encodeXFetch([]byte("1"), time.Millisecond, time.Second),
+				Flags:      FlagXFetch,
+				Expiration: time.Minute,
+			}
+			Expect(mc.Set(expiring)).To(Succeed())
+			time.Sleep(10 * time.Millisecond)
+
+			version.Store(2)
+			values := refreshAll(mc, "xfetch_early", time.Minute, loader)
+			Expect(values).To(ContainElement("2"))
+			Expect(values).To(HaveEach(BeElementOf("1", "2")))
+			Expect(loads.Load()).To(Equal(int32(1)))
+
+			By("The callers drawing a refresh while one runs are not blocked")
+			Expect(mc.Set(expiring)).To(Succeed())
+			time.Sleep(10 * time.Millisecond)
+
+			release := make(chan struct{})
+			refreshed := make(chan []byte, 1)
+			go func() {
+				defer GinkgoRecover()
+
+				value, err := mc.GetOrRefresh(context.Background(), "xfetch_early", time.Minute, func() ([]byte, error) {
+					<-release
+					return []byte("3"), nil
+				})
+				Expect(err).ToNot(HaveOccurred())
+				refreshed <- value
+			}()
+
+			Eventually(func() int {
+				mc.flights.mu.Lock()
+				defer mc.flights.mu.Unlock()
+				return len(mc.flights.calls)
+			}).Should(Equal(1))
+
+			value, err := mc.GetOrRefresh(context.Background(), "xfetch_early", time.Minute, loader)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal([]byte("1")))
+
+			close(release)
+			Eventually(refreshed).Should(Receive(Equal([]byte("3"))))
+			Expect(loads.Load()).To(Equal(int32(1)))
+
+			By("A failed refresh serves the current value")
+			Expect(mc.Set(expiring)).To(Succeed())
+			time.Sleep(10 * time.Millisecond)
+
+			value, err = mc.GetOrRefresh(context.Background(), "xfetch_early", time.Minute, func() ([]byte, error) {
+				return nil, errors.New("database is down")
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal([]byte("1")))
+		})
+
+		It("A text client falls back to XFetch on a server without mg", func() {
+			old := oldServer(defaultAddr)
+			defer old.Close()
+
+			text := New([]string{old.Addr().String()}, 4)
+			Expect(text).ToNot(BeNil())
+			defer text.Close()
+
+			Expect(refreshAll(text, "xfetch_text", time.Minute, loader)).To(HaveEach("1"))
+			Expect(loads.Load()).To(Equal(int32(1)))
+			Expect(text.noMetaGet.Load()).To(BeTrue())
+
+			it, err := mc.Get("xfetch_text")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(it.Flags).To(Equal(FlagXFetch))
+		})
+
+		It("Values stored by other commands are returned as they are", func() {
+			Expect(mc.Set(&Item{Key: "xfetch_plain", Value: []byte("plain")})).To(Succeed())
+
+			value, err := mc.GetOrRefresh(context.Background(), "xfetch_plain", time.Minute, loader)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal([]byte("plain")))
+			Expect(loads.Load()).To(BeZero())
+		})
+	})
+})
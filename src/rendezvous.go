@@ -0,0 +1,104 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"hash/fnv"
+	"net"
+	"sort"
+)
+
+// Rendezvous picks servers by highest random weight hashing.
+// Every server is scored by the hash of its address and the key
+// and the server with the highest score wins, so removing a server
+// only remaps the keys it owned.
+// It is concurrent-safe.
+type Rendezvous struct {
+	ServerList
+}
+
+// PickServer returns the server with the highest score for the key.
+func (r *Rendezvous) PickServer(key string) (net.Addr, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.addrs) == 0 {
+		return nil, ErrNoServers
+	}
+
+	var (
+		best      net.Addr
+		bestScore uint64
+	)
+
+	for _, addr := range r.addrs {
+		if score := rendezvousScore(addr.String(), key); best == nil || score > bestScore {
+			best, bestScore = addr, score
+		}
+	}
+
+	return best, nil
+}
+
+// PickServers returns the servers ordered by their score for the key.
+func (r *Rendezvous) PickServers(key string) ([]net.Addr, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.addrs) == 0 {
+		return nil, ErrNoServers
+	}
+
+	scores := make(map[net.Addr]uint64, len(r.addrs))
+	for _, addr := range r.addrs {
+		scores[addr] = rendezvousScore(addr.String(), key)
+	}
+
+	addrs := append([]net.Addr(nil), r.addrs...)
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return scores[addrs[i]] > scores[addrs[j]]
+	})
+
+	return addrs, nil
+}
+
+func rendezvousScore(server, key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(server))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+
+	return mix64(h.Sum64())
+}
+
+// mix64 is the finalizer of MurmurHash3 which spreads
+// the bits of similar FNV hashes.
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+
+	return h
+}
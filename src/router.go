@@ -23,7 +23,6 @@
 package memcache
 
 import (
-	"bufio"
 	"hash/crc32"
 	"net"
 	"strings"
@@ -31,30 +30,18 @@ import (
 )
 
 // ServerList holds the list of all server addresses.
+// It picks a server by the CRC32 of the key modulo the number of servers.
 // It is concurrent-safe.
 type ServerList struct {
 	mu    sync.RWMutex
 	addrs []net.Addr
 }
 
-func (sl *ServerList) addServer(addresses ...string) error {
-	addrs := make([]net.Addr, len(addresses))
-
-	// Establish connection with the addresses
-	for i, server := range addresses {
-		if strings.Contains(server, "/") {
-			addr, err := net.ResolveUnixAddr("unix", server)
-			if err != nil {
-				return ErrEstablishConnection
-			}
-			addrs[i] = addr
-		} else {
-			addr, err := net.ResolveTCPAddr("tcp", server)
-			if err != nil {
-				return ErrEstablishConnection
-			}
-			addrs[i] = addr
-		}
+// SetServers replaces the servers of the list.
+func (sl *ServerList) SetServers(addresses ...string) error {
+	addrs, err := resolveAddrs(addresses)
+	if err != nil {
+		return err
 	}
 
 	sl.mu.Lock()
@@ -64,40 +51,73 @@ func (sl *ServerList) addServer(addresses ...string) error {
 	return nil
 }
 
-// InitializeConnectionPool creates connections for server addresses.
-func (sl *ServerList) InitializeConnectionPool(connCount int) (map[string][]*Connection, error) {
-	mcp := make(map[string][]*Connection)
-
+// PickServer returns the server responsible for the key.
+func (sl *ServerList) PickServer(key string) (net.Addr, error) {
 	sl.mu.RLock()
 	defer sl.mu.RUnlock()
 
-	for _, addr := range sl.addrs {
-		for i := 0; i < connCount; i++ {
-
-			cp := &Connection{}
+	if len(sl.addrs) == 0 {
+		return nil, ErrNoServers
+	}
 
-			conn, err := net.Dial(addr.Network(), addr.String())
-			if err != nil {
-				return nil, err
-			}
-			cp.conn = conn
+	return sl.addrs[int(crc32.ChecksumIEEE([]byte(key)))%len(sl.addrs)], nil
+}
 
-			cp.rw = bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+// PickServers returns the server responsible for the key
+// followed by the servers after it in the list.
+func (sl *ServerList) PickServers(key string) ([]net.Addr, error) {
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
 
-			mcp[addr.String()] = append(mcp[addr.String()], cp)
-		}
+	if len(sl.addrs) == 0 {
+		return nil, ErrNoServers
 	}
 
-	return mcp, nil
+	return rotateAddrs(sl.addrs, int(crc32.ChecksumIEEE([]byte(key)))%len(sl.addrs)), nil
 }
 
-func (sl *ServerList) pickServer(key string) (net.Addr, error) {
+// Each calls fn for every server until it returns an error.
+func (sl *ServerList) Each(fn func(net.Addr) error) error {
 	sl.mu.RLock()
 	defer sl.mu.RUnlock()
 
-	if len(sl.addrs) == 0 {
-		return nil, ErrNoServers
+	for _, addr := range sl.addrs {
+		if err := fn(addr); err != nil {
+			return err
+		}
 	}
 
-	return sl.addrs[int(crc32.ChecksumIEEE([]byte(key)))%len(sl.addrs)], nil
+	return nil
+}
+
+// rotateAddrs returns a copy of the servers starting at the i-th one.
+func rotateAddrs(addrs []net.Addr, i int) []net.Addr {
+	res := make([]net.Addr, 0, len(addrs))
+	res = append(res, addrs[i:]...)
+
+	return append(res, addrs[:i]...)
+}
+
+// resolveAddrs resolves the server addresses,
+// the ones containing a slash are unix sockets.
+func resolveAddrs(addresses []string) ([]net.Addr, error) {
+	addrs := make([]net.Addr, len(addresses))
+
+	for i, server := range addresses {
+		if strings.Contains(server, "/") {
+			addr, err := net.ResolveUnixAddr("unix", server)
+			if err != nil {
+				return nil, ErrEstablishConnection
+			}
+			addrs[i] = addr
+		} else {
+			addr, err := net.ResolveTCPAddr("tcp", server)
+			if err != nil {
+				return nil, ErrEstablishConnection
+			}
+			addrs[i] = addr
+		}
+	}
+
+	return addrs, nil
 }
@@ -0,0 +1,152 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// prefixSelector pins the keys with a prefix to a dedicated server.
+type prefixSelector struct {
+	ServerList
+	pinned net.Addr
+	picks  atomic.Int32
+}
+
+func (p *prefixSelector) PickServer(key string) (net.Addr, error) {
+	p.picks.Add(1)
+
+	if strings.HasPrefix(key, "pinned:") {
+		return p.pinned, nil
+	}
+
+	return p.ServerList.PickServer(key)
+}
+
+var _ = Describe("Memcache Server Selector Tests", Label("ServerSelector"), func() {
+	servers := []string{"10.0.1.1:11211", "10.0.1.2:11211", "10.0.1.3:11211", "10.0.1.4:11211"}
+
+	remapped := func(s interface {
+		ServerSelector
+		serverSetter
+	}, before, after []string) (int, map[string]int) {
+		Expect(s.SetServers(before...)).To(Succeed())
+
+		placement := make(map[string]string)
+		for i := 0; i < 10000; i++ {
+			key := fmt.Sprintf("key_%d", i)
+			addr, err := s.PickServer(key)
+			Expect(err).ToNot(HaveOccurred())
+			placement[key] = addr.String()
+		}
+
+		Expect(s.SetServers(after...)).To(Succeed())
+
+		moved := 0
+		counts := make(map[string]int)
+		for key, addr := range placement {
+			newAddr, err := s.PickServer(key)
+			Expect(err).ToNot(HaveOccurred())
+			counts[newAddr.String()]++
+			if newAddr.String() != addr {
+				moved++
+			}
+		}
+
+		return moved, counts
+	}
+
+	It("Rendezvous only remaps the keys of a removed server", func() {
+		moved, counts := remapped(&Rendezvous{}, servers, servers[1:])
+		Expect(moved).To(BeNumerically("~", 2500, 500))
+		for _, addr := range servers[1:] {
+			Expect(counts[addr]).To(BeNumerically("~", 3333, 500))
+		}
+	})
+
+	It("JumpHash only remaps the keys taken by an appended server", func() {
+		moved, counts := remapped(&JumpHash{}, servers[:3], servers)
+		Expect(moved).To(BeNumerically("~", 2500, 500))
+		for _, addr := range servers {
+			Expect(counts[addr]).To(BeNumerically("~", 2500, 500))
+		}
+	})
+
+	It("The modulo ServerList remaps most of the keys", func() {
+		moved, _ := remapped(&ServerList{}, servers, servers[1:])
+		Expect(moved).To(BeNumerically(">", 5000))
+	})
+
+	It("Failover order starts with the picked server", func() {
+		for _, s := range []FailoverSelector{&ServerList{}, &Ketama{}, &Rendezvous{}, &JumpHash{}} {
+			Expect(s.(serverSetter).SetServers(servers...)).To(Succeed())
+
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("key_%d", i)
+				addr, err := s.PickServer(key)
+				Expect(err).ToNot(HaveOccurred())
+
+				addrs, err := s.PickServers(key)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(addrs).To(HaveLen(len(servers)))
+				Expect(addrs[0]).To(Equal(addr))
+
+				seen := make(map[string]bool)
+				for _, a := range addrs {
+					seen[a.String()] = true
+				}
+				Expect(seen).To(HaveLen(len(servers)))
+			}
+		}
+	})
+
+	It("Selectors without servers fail", func() {
+		for _, s := range []ServerSelector{&ServerList{}, &Ketama{}, &Rendezvous{}, &JumpHash{}} {
+			_, err := s.PickServer("key")
+			Expect(err).To(MatchError(ErrNoServers))
+		}
+	})
+
+	It("Memcache Commands with a custom selector", func() {
+		addr, err := net.ResolveTCPAddr("tcp", defaultAddr)
+		Expect(err).ToNot(HaveOccurred())
+
+		sel := &prefixSelector{pinned: addr}
+		mc := New([]string{defaultAddr}, 1, WithServerSelector(sel))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		Expect(mc.Set(&Item{Key: "pinned:key", Value: []byte("value"), Expiration: time.Minute})).To(Succeed())
+		it, err := mc.Get("pinned:key")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("value")))
+		Expect(sel.picks.Load()).To(Equal(int32(2)))
+	})
+})
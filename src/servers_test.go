@@ -0,0 +1,163 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache Server Set Tests", Label("SetServers"), func() {
+	var mc *Client
+
+	BeforeEach(func() {
+		mc = New([]string{defaultAddr}, 2)
+		Expect(mc).ToNot(BeNil())
+	})
+
+	AfterEach(func() {
+		mc.Close()
+	})
+
+	It("Pools follow the server set", func() {
+		Expect(mc.Health()).To(HaveLen(1))
+
+		Expect(mc.SetServers(defaultAddr, secondAddr)).To(Succeed())
+		Expect(mc.Health()).To(HaveKey(defaultAddr))
+		Expect(mc.Health()).To(HaveKey(secondAddr))
+
+		mc.mu.Lock()
+		removed := mc.pools[defaultAddr]
+		mc.mu.Unlock()
+
+		Expect(mc.SetServers(secondAddr)).To(Succeed())
+		Expect(mc.Health()).To(HaveLen(1))
+		Expect(mc.Health()).To(HaveKey(secondAddr))
+		Expect(removed.closed).To(BeTrue())
+
+		Expect(mc.Set(&Item{Key: "servers_key", Value: []byte("value"), Expiration: time.Minute})).To(Succeed())
+		it, err := mc.Get("servers_key")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(it.Value).To(Equal([]byte("value")))
+	})
+
+	It("Invalid servers keep the current set", func() {
+		Expect(mc.SetServers("invalid:address:1")).To(MatchError(ErrEstablishConnection))
+		Expect(mc.Health()).To(HaveLen(1))
+		Expect(mc.Set(&Item{Key: "servers_key", Value: []byte("value")})).To(Succeed())
+	})
+
+	It("Selectors without SetServers fail", func() {
+		sl := &ServerList{}
+		Expect(sl.SetServers(defaultAddr)).To(Succeed())
+
+		mc := New(nil, 1, WithServerSelector(fixedSelector{sl}))
+		Expect(mc).ToNot(BeNil())
+		defer mc.Close()
+
+		Expect(mc.SetServers(secondAddr)).ToNot(Succeed())
+	})
+
+	It("Operations keep working while the servers change", func() {
+		var wg sync.WaitGroup
+		errs := make(chan error, 8)
+		done := make(chan struct{})
+
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				for j := 0; ; j++ {
+					select {
+					case <-done:
+						return
+					default:
+					}
+
+					key := fmt.Sprintf("servers_%d_%d", i, j)
+					if err := mc.Set(&Item{Key: key, Value: []byte("value")}); err != nil {
+						errs <- err
+						return
+					}
+
+					var (
+						items []*Item
+						keys  []string
+					)
+					for k := 0; k < 8; k++ {
+						key := fmt.Sprintf("servers_multi_%d_%d_%d", i, j, k)
+						items = append(items, &Item{Key: key, Value: []byte("value")})
+						keys = append(keys, key)
+					}
+
+					for _, err := range mc.SetMulti(items) {
+						errs <- err
+						return
+					}
+
+					if _, err := mc.GetMulti(keys); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}(i)
+		}
+
+		for i := 0; i < 20; i++ {
+			if i%2 == 0 {
+				Expect(mc.SetServers(defaultAddr, secondAddr)).To(Succeed())
+			} else {
+				Expect(mc.SetServers(secondAddr)).To(Succeed())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		close(done)
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			Expect(err).ToNot(HaveOccurred())
+		}
+	})
+})
+
+// fixedSelector hides the SetServers method of the server list.
+type fixedSelector struct {
+	sl *ServerList
+}
+
+func (f fixedSelector) PickServer(key string) (net.Addr, error) {
+	return f.sl.PickServer(key)
+}
+
+func (f fixedSelector) Each(fn func(net.Addr) error) error {
+	return f.sl.Each(fn)
+}
@@ -0,0 +1,287 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The stats commands query every server of the client, or only the servers
+// given by their addresses, and return the parsed statistics keyed by the
+// address of the server. Statistics missing from the response are zero.
+
+// Stats returns the general statistics of the servers.
+func (c *Client) Stats(addrs ...string) (map[string]*Stats, error) {
+	return collectStats(context.Background(), c, "", addrs, parseStats)
+}
+
+// StatsContext is like Stats but honours the deadline and cancellation of ctx.
+func (c *Client) StatsContext(ctx context.Context, addrs ...string) (map[string]*Stats, error) {
+	return collectStats(ctx, c, "", addrs, parseStats)
+}
+
+// StatsSlabs returns the statistics of the slab classes of the servers.
+func (c *Client) StatsSlabs(addrs ...string) (map[string]*SlabStats, error) {
+	return collectStats(context.Background(), c, "slabs", addrs, parseSlabStats)
+}
+
+// StatsSlabsContext is like StatsSlabs but honours the deadline and cancellation of ctx.
+func (c *Client) StatsSlabsContext(ctx context.Context, addrs ...string) (map[string]*SlabStats, error) {
+	return collectStats(ctx, c, "slabs", addrs, parseSlabStats)
+}
+
+// StatsItems returns the statistics of the items of the servers keyed by the slab class id.
+func (c *Client) StatsItems(addrs ...string) (map[string]map[int]ItemClass, error) {
+	return collectStats(context.Background(), c, "items", addrs, parseItemStats)
+}
+
+// StatsItemsContext is like StatsItems but honours the deadline and cancellation of ctx.
+func (c *Client) StatsItemsContext(ctx context.Context, addrs ...string) (map[string]map[int]ItemClass, error) {
+	return collectStats(ctx, c, "items", addrs, parseItemStats)
+}
+
+// StatsSettings returns the settings of the servers.
+func (c *Client) StatsSettings(addrs ...string) (map[string]*Settings, error) {
+	return collectStats(context.Background(), c, "settings", addrs, parseSettings)
+}
+
+// StatsSettingsContext is like StatsSettings but honours the deadline and cancellation of ctx.
+func (c *Client) StatsSettingsContext(ctx context.Context, addrs ...string) (map[string]*Settings, error) {
+	return collectStats(ctx, c, "settings", addrs, parseSettings)
+}
+
+// StatsConns returns the connections open to the servers.
+func (c *Client) StatsConns(addrs ...string) (map[string][]ConnStats, error) {
+	return collectStats(context.Background(), c, "conns", addrs, parseConnStats)
+}
+
+// StatsConnsContext is like StatsConns but honours the deadline and cancellation of ctx.
+func (c *Client) StatsConnsContext(ctx context.Context, addrs ...string) (map[string][]ConnStats, error) {
+	return collectStats(ctx, c, "conns", addrs, parseConnStats)
+}
+
+// StatsSizes returns the number of items of the servers keyed by their size
+// rounded up to 32 bytes. The servers have to track the sizes.
+func (c *Client) StatsSizes(addrs ...string) (map[string]map[int]uint64, error) {
+	return collectStats(context.Background(), c, "sizes", addrs, parseSizeStats)
+}
+
+// StatsSizesContext is like StatsSizes but honours the deadline and cancellation of ctx.
+func (c *Client) StatsSizesContext(ctx context.Context, addrs ...string) (map[string]map[int]uint64, error) {
+	return collectStats(ctx, c, "sizes", addrs, parseSizeStats)
+}
+
+func collectStats[T any](ctx context.Context, c *Client, group string, addrs []string, parse func(statsMap) T) (map[string]T, error) {
+	var mu sync.Mutex
+	res := make(map[string]T)
+
+	err := c.eachServer(ctx, addrs, func(cn *Connection) error {
+		return c.adminFn("stats", cn, func() error {
+			raw, err := c.protocol.stats(cn, group)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			res[cn.pool.addr.String()] = parse(raw)
+			mu.Unlock()
+
+			return nil
+		})
+	})
+
+	return res, err
+}
+
+func parseStats(m statsMap) *Stats {
+	return &Stats{
+		PID:              m.int("pid"),
+		Uptime:           m.seconds("uptime"),
+		Time:             time.Unix(int64(m.uint("time")), 0),
+		Version:          m["version"],
+		CurrConnections:  m.uint("curr_connections"),
+		TotalConnections: m.uint("total_connections"),
+		CmdGet:           m.uint("cmd_get"),
+		CmdSet:           m.uint("cmd_set"),
+		CmdFlush:         m.uint("cmd_flush"),
+		CmdTouch:         m.uint("cmd_touch"),
+		GetHits:          m.uint("get_hits"),
+		GetMisses:        m.uint("get_misses"),
+		GetExpired:       m.uint("get_expired"),
+		DeleteHits:       m.uint("delete_hits"),
+		DeleteMisses:     m.uint("delete_misses"),
+		BytesRead:        m.uint("bytes_read"),
+		BytesWritten:     m.uint("bytes_written"),
+		Bytes:            m.uint("bytes"),
+		LimitMaxBytes:    m.uint("limit_maxbytes"),
+		CurrItems:        m.uint("curr_items"),
+		TotalItems:       m.uint("total_items"),
+		Evictions:        m.uint("evictions"),
+		Reclaimed:        m.uint("reclaimed"),
+		Threads:          m.int("threads"),
+		Raw:              m,
+	}
+}
+
+func parseSlabStats(m statsMap) *SlabStats {
+	res := &SlabStats{
+		Classes:       make(map[int]SlabClass),
+		ActiveSlabs:   m.int("active_slabs"),
+		TotalMalloced: m.uint("total_malloced"),
+		Raw:           m,
+	}
+
+	for id, class := range m.classes("") {
+		res.Classes[id] = SlabClass{
+			ChunkSize:     class.uint("chunk_size"),
+			ChunksPerPage: class.uint("chunks_per_page"),
+			TotalPages:    class.uint("total_pages"),
+			TotalChunks:   class.uint("total_chunks"),
+			UsedChunks:    class.uint("used_chunks"),
+			FreeChunks:    class.uint("free_chunks"),
+			MemRequested:  class.uint("mem_requested"),
+			GetHits:       class.uint("get_hits"),
+			CmdSet:        class.uint("cmd_set"),
+		}
+	}
+
+	return res
+}
+
+func parseItemStats(m statsMap) map[int]ItemClass {
+	res := make(map[int]ItemClass)
+
+	for id, class := range m.classes("items:") {
+		res[id] = ItemClass{
+			Number:           class.uint("number"),
+			Age:              class.seconds("age"),
+			Evicted:          class.uint("evicted"),
+			EvictedNonzero:   class.uint("evicted_nonzero"),
+			OutOfMemory:      class.uint("outofmemory"),
+			Reclaimed:        class.uint("reclaimed"),
+			ExpiredUnfetched: class.uint("expired_unfetched"),
+			EvictedUnfetched: class.uint("evicted_unfetched"),
+		}
+	}
+
+	return res
+}
+
+func parseSettings(m statsMap) *Settings {
+	factor, _ := strconv.ParseFloat(m["growth_factor"], 64)
+
+	return &Settings{
+		MaxBytes:     m.uint("maxbytes"),
+		MaxConns:     m.int("maxconns"),
+		TCPPort:      m.int("tcpport"),
+		UDPPort:      m.int("udpport"),
+		Verbosity:    m.int("verbosity"),
+		NumThreads:   m.int("num_threads"),
+		ItemSizeMax:  m.uint("item_size_max"),
+		ChunkSize:    m.int("chunk_size"),
+		GrowthFactor: factor,
+		Evictions:    m["evictions"] == "on",
+		CASEnabled:   m["cas_enabled"] == "yes",
+		Raw:          m,
+	}
+}
+
+func parseConnStats(m statsMap) []ConnStats {
+	classes := m.classes("")
+	res := make([]ConnStats, 0, len(classes))
+
+	for fd, conn := range classes {
+		res = append(res, ConnStats{
+			FD:               fd,
+			Addr:             conn["addr"],
+			ListenAddr:       conn["listen_addr"],
+			State:            conn["state"],
+			SinceLastCommand: conn.seconds("secs_since_last_cmd"),
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].FD < res[j].FD
+	})
+
+	return res
+}
+
+func parseSizeStats(m statsMap) map[int]uint64 {
+	res := make(map[int]uint64)
+
+	for k := range m {
+		if size, err := strconv.Atoi(k); err == nil {
+			res[size] = m.uint(k)
+		}
+	}
+
+	return res
+}
+
+// statsMap holds the raw statistics, the values
+// which cannot be parsed are read as zero.
+type statsMap map[string]string
+
+func (m statsMap) uint(key string) uint64 {
+	v, _ := strconv.ParseUint(m[key], 10, 64)
+	return v
+}
+
+func (m statsMap) int(key string) int {
+	v, _ := strconv.Atoi(m[key])
+	return v
+}
+
+func (m statsMap) seconds(key string) time.Duration {
+	return time.Duration(m.int(key)) * time.Second
+}
+
+// classes groups the statistics named prefix<id>:<name> by the id.
+func (m statsMap) classes(prefix string) map[int]statsMap {
+	res := make(map[int]statsMap)
+
+	for k, v := range m {
+		idStr, name, ok := strings.Cut(strings.TrimPrefix(k, prefix), ":")
+		if !ok || !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			continue
+		}
+
+		if res[id] == nil {
+			res[id] = make(statsMap)
+		}
+		res[id][name] = v
+	}
+
+	return res
+}
@@ -0,0 +1,123 @@
+// MIT License
+//
+// Copyright (c) 2024 Odvarka Daniel
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package memcache
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcache Stats Tests", Label("Stats"), func() {
+	for _, proto := range []ProtocolType{TextProtocol, BinaryProtocol} {
+		proto := proto
+
+		It("Stats are parsed for every server", func() {
+			mc := New([]string{defaultAddr, secondAddr}, 1, WithProtocol(proto))
+			Expect(mc).ToNot(BeNil())
+			defer mc.Close()
+
+			Expect(mc.Set(&Item{Key: "stats_key", Value: []byte("value"), Expiration: time.Minute})).To(Succeed())
+			_, err := mc.Get("stats_key")
+			Expect(err).ToNot(HaveOccurred())
+
+			By("General stats")
+			stats, err := mc.Stats()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats).To(HaveLen(2))
+			Expect(stats[defaultAddr].PID).ToNot(BeZero())
+			Expect(stats[defaultAddr].Version).ToNot(BeEmpty())
+			Expect(stats[defaultAddr].LimitMaxBytes).ToNot(BeZero())
+			Expect(stats[defaultAddr].GetHits + stats[secondAddr].GetHits).ToNot(BeZero())
+			Expect(stats[defaultAddr].CurrItems + stats[secondAddr].CurrItems).ToNot(BeZero())
+			Expect(stats[defaultAddr].Raw).To(HaveKey("uptime"))
+
+			By("Slab stats")
+			slabs, err := mc.StatsSlabs(defaultAddr)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(slabs).To(HaveLen(1))
+			Expect(slabs[defaultAddr].ActiveSlabs).ToNot(BeZero())
+			Expect(slabs[defaultAddr].Classes).ToNot(BeEmpty())
+			for _, class := range slabs[defaultAddr].Classes {
+				Expect(class.ChunkSize).ToNot(BeZero())
+			}
+
+			By("Item stats")
+			items, err := mc.StatsItems(defaultAddr)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(items[defaultAddr]).ToNot(BeEmpty())
+
+			By("Settings")
+			settings, err := mc.StatsSettings()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(settings[defaultAddr].MaxBytes).ToNot(BeZero())
+			Expect(settings[defaultAddr].MaxConns).ToNot(BeZero())
+			Expect(settings[defaultAddr].CASEnabled).To(BeTrue())
+
+			By("Connections and sizes")
+			conns, err := mc.StatsConns(defaultAddr)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(conns[defaultAddr]).ToNot(BeEmpty())
+			Expect(conns[defaultAddr][0].State).ToNot(BeEmpty())
+
+			_, err = mc.StatsSizes(defaultAddr)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	}
+
+	It("Stats lines are parsed into the typed fields", func() {
+		m := statsMap{
+			"uptime":          "120",
+			"curr_items":      "42",
+			"1:chunk_size":    "96",
+			"1:used_chunks":   "3",
+			"12:chunk_size":   "1184",
+			"items:7:age":     "60",
+			"items:7:evicted": "5",
+			"growth_factor":   "1.25",
+			"evictions":       "off",
+			"bogus":           "not a number",
+			"total_malloced":  "not a number",
+		}
+
+		stats := parseStats(m)
+		Expect(stats.Uptime).To(Equal(2 * time.Minute))
+		Expect(stats.CurrItems).To(Equal(uint64(42)))
+
+		slabs := parseSlabStats(m)
+		Expect(slabs.Classes).To(HaveLen(2))
+		Expect(slabs.Classes[1].UsedChunks).To(Equal(uint64(3)))
+		Expect(slabs.Classes[12].ChunkSize).To(Equal(uint64(1184)))
+		Expect(slabs.TotalMalloced).To(BeZero())
+
+		items := parseItemStats(m)
+		Expect(items).To(HaveLen(1))
+		Expect(items[7].Age).To(Equal(time.Minute))
+		Expect(items[7].Evicted).To(Equal(uint64(5)))
+
+		settings := parseSettings(m)
+		Expect(settings.GrowthFactor).To(Equal(1.25))
+		Expect(settings.Evictions).To(BeFalse())
+	})
+})
@@ -37,27 +37,33 @@ func TestMemcache(t *testing.T) {
 	RunSpecs(t, "Memcache Suite")
 }
 
-var cmd *exec.Cmd
+var cmds []*exec.Cmd
 var defaultPort string = "11211"
+var secondPort string = "11212"
 var defaultIP string = "127.0.0.1"
 
 var _ = BeforeSuite(func() {
-	cmd = exec.Command("memcached",
-		"--port="+defaultPort,
-		"--listen="+defaultIP)
+	for _, port := range []string{defaultPort, secondPort} {
+		cmd := exec.Command("memcached",
+			"--port="+port,
+			"--listen="+defaultIP)
 
-	err := cmd.Start()
-	Expect(err).ToNot(HaveOccurred(), "failed to start memcached")
+		err := cmd.Start()
+		Expect(err).ToNot(HaveOccurred(), "failed to start memcached")
+		cmds = append(cmds, cmd)
 
-	for i := 0; i < 5; i++ {
-		if nc, err := net.Dial("tcp", "127.0.0.1:11211"); err == nil {
-			nc.Close()
-			break
+		for i := 0; i < 5; i++ {
+			if nc, err := net.Dial("tcp", defaultIP+":"+port); err == nil {
+				nc.Close()
+				break
+			}
+			time.Sleep(time.Duration(50*i) * time.Millisecond)
 		}
-		time.Sleep(time.Duration(50*i) * time.Millisecond)
 	}
 })
 
 var _ = AfterSuite(func() {
-	cmd.Process.Kill()
+	for _, cmd := range cmds {
+		cmd.Process.Kill()
+	}
 })
@@ -24,9 +24,11 @@ package memcache
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -37,6 +39,14 @@ const (
 	UNIX
 )
 
+// ProtocolType selects the framing used to talk to the servers.
+type ProtocolType int8
+
+const (
+	TextProtocol ProtocolType = iota
+	BinaryProtocol
+)
+
 var (
 	ErrEstablishConnection = errors.New("failed to establish connection")
 	ErrNoServers           = errors.New("no servers are currently connected")
@@ -45,8 +55,34 @@ var (
 	ErrClientError         = errors.New("failed to store Value while appending/prepending")
 	ErrExists              = errors.New("someone else has modified the CAS Value since last fetch")
 	ErrCacheMiss           = errors.New("key does not exist in the server")
+	ErrServerError         = errors.New("server failed to process the command")
+	ErrNotSupported        = errors.New("command is not supported by the protocol")
+	ErrPoolTimeout         = errors.New("timed out waiting for a free connection")
+	ErrPoolClosed          = errors.New("connection pool is closed")
+	ErrServerDown          = errors.New("server is down")
+	ErrMalformedResponse   = errors.New("malformed response from the server")
+	ErrMalformedKey        = errors.New("key is empty, longer than 250 bytes or contains spaces or control characters")
+	ErrCompression         = errors.New("failed to compress or decompress the value")
+	ErrCodec               = errors.New("failed to encode or decode the object")
+	ErrLocked              = errors.New("lock is held by another owner")
+	ErrLockLost            = errors.New("lock is not held by this owner")
+	ErrAuthFailed          = errors.New("authentication failed")
 )
 
+// Error describes a command which failed on a server.
+// It wraps one of the sentinel errors, so it can be checked with errors.Is,
+// e.g. errors.Is(err, ErrCacheMiss), and inspected with errors.As.
+type Error struct {
+	// Kind is the sentinel error, e.g. ErrNotStored or ErrServerError.
+	Kind error
+	// Addr is the address of the server.
+	Addr string
+	// Verb is the command which failed, e.g. set or get.
+	Verb string
+	// Msg is the message sent by the server, if any.
+	Msg string
+}
+
 // Item represent a memcache item object
 type Item struct {
 	Key        string
@@ -56,20 +92,249 @@ type Item struct {
 	CAS        int64
 }
 
+// MetaFlag is a single flag sent along with a meta command.
+// It consists of a one character token and an optional argument.
+type MetaFlag struct {
+	token byte
+	arg   string
+}
+
+// MetaResult represents a response to a meta command.
+// Only the fields requested by the return flags are filled.
+type MetaResult struct {
+	// Status is the two character return code, e.g. HD, VA or MN.
+	Status     string
+	Key        string
+	Value      []byte
+	Flags      int32
+	CAS        int64
+	Size       int
+	Opaque     string
+	HitBefore  bool
+	LastAccess time.Duration
+	// TTL is the remaining time to live, -1 if the item never expires.
+	TTL time.Duration
+	// Win is set when the client should recache the item.
+	Win bool
+	// Stale is set when the item was marked as stale.
+	Stale bool
+	// AlreadyWon is set when another client has already won the recache.
+	AlreadyWon bool
+}
+
 // Client is the object that is exposed to the user.
 // It allows the user to interact with the API.
 type Client struct {
-	mu            sync.Mutex
-	router        *ServerList
-	idleConnCount int
-	connPool      map[string][]*Connection
+	mu              sync.Mutex
+	updateMu        sync.Mutex
+	router          ServerSelector
+	protocol        protocol
+	timeout         time.Duration
+	maxOpen         int
+	maxIdle         int
+	poolWaitTimeout time.Duration
+	minBackoff      time.Duration
+	maxBackoff      time.Duration
+	markDownAfter   int
+	deadTimeout     time.Duration
+	failover        bool
+	pipelineConns   int
+	compressor      Compressor
+	compressMin     int
+	chunkSize       int
+	keyPrefix       string
+	hashKeys        bool
+	binaryKeys      bool
+	username        string
+	password        string
+	leaseTTL        time.Duration
+	leasePoll       time.Duration
+	flights         flightGroup
+	noMetaGet       atomic.Bool
+	near            *nearCache
+	codec           Codec
+	codecs          map[uint8]Codec
+	pools           map[string]*connPool
+}
+
+// ServerHealth describes the state of the connections to a server.
+type ServerHealth struct {
+	// Healthy is false when the last operation failed.
+	Healthy bool
+	// Failures counts the consecutive failed operations.
+	Failures  int
+	LastError error
+	// RetryAt is when the server is dialed again after a failed dial.
+	RetryAt time.Time
+	// Down is set while the server is marked down, see WithMarkDown.
+	Down bool
+	// Idle is the number of idle connections in the pool.
+	Idle int
+}
+
+// Stats holds the general statistics of a server.
+type Stats struct {
+	PID              int
+	Uptime           time.Duration
+	Time             time.Time
+	Version          string
+	CurrConnections  uint64
+	TotalConnections uint64
+	CmdGet           uint64
+	CmdSet           uint64
+	CmdFlush         uint64
+	CmdTouch         uint64
+	GetHits          uint64
+	GetMisses        uint64
+	GetExpired       uint64
+	DeleteHits       uint64
+	DeleteMisses     uint64
+	BytesRead        uint64
+	BytesWritten     uint64
+	// Bytes is the number of bytes used to store the items.
+	Bytes         uint64
+	LimitMaxBytes uint64
+	CurrItems     uint64
+	TotalItems    uint64
+	Evictions     uint64
+	Reclaimed     uint64
+	Threads       int
+	// Raw holds all the statistics as they were sent by the server.
+	Raw map[string]string
+}
+
+// SlabStats holds the statistics of the slab classes of a server.
+type SlabStats struct {
+	// Classes are keyed by the slab class id.
+	Classes       map[int]SlabClass
+	ActiveSlabs   int
+	TotalMalloced uint64
+	Raw           map[string]string
+}
+
+// SlabClass holds the statistics of a single slab class.
+type SlabClass struct {
+	ChunkSize     uint64
+	ChunksPerPage uint64
+	TotalPages    uint64
+	TotalChunks   uint64
+	UsedChunks    uint64
+	FreeChunks    uint64
+	MemRequested  uint64
+	GetHits       uint64
+	CmdSet        uint64
+}
+
+// ItemClass holds the statistics of the items of a single slab class.
+type ItemClass struct {
+	Number uint64
+	// Age of the oldest item in the class.
+	Age              time.Duration
+	Evicted          uint64
+	EvictedNonzero   uint64
+	OutOfMemory      uint64
+	Reclaimed        uint64
+	ExpiredUnfetched uint64
+	EvictedUnfetched uint64
 }
 
+// Settings holds the settings of a server.
+type Settings struct {
+	MaxBytes     uint64
+	MaxConns     int
+	TCPPort      int
+	UDPPort      int
+	Verbosity    int
+	NumThreads   int
+	ItemSizeMax  uint64
+	ChunkSize    int
+	GrowthFactor float64
+	Evictions    bool
+	CASEnabled   bool
+	Raw          map[string]string
+}
+
+// ConnStats describes a single connection to a server.
+type ConnStats struct {
+	FD               int
+	Addr             string
+	ListenAddr       string
+	State            string
+	SinceLastCommand time.Duration
+}
+
+// Option configures a Client when it is created.
+type Option func(*Client)
+
 // Connection represents a single connection to a server.
 // We want to hold the connection itself and also a ReadWriter
 // due to optimizations.
 type Connection struct {
-	owner string
-	conn  net.Conn
-	rw    *bufio.ReadWriter
+	pool   *connPool
+	conn   net.Conn
+	rw     *bufio.ReadWriter
+	opaque uint32
+	stop   func() bool
+
+	// With pipelining, every operation gets its own Connection
+	// which shares the network connection with other operations.
+	shared   *sharedConn
+	writing  bool
+	turn     chan struct{}
+	ctx      context.Context
+	deadline time.Time
+}
+
+// ServerSelector decides which server is responsible for a key.
+// A custom implementation can be plugged in with WithServerSelector.
+// It has to be concurrent-safe.
+type ServerSelector interface {
+	// PickServer returns the address of the server responsible for the key.
+	PickServer(key string) (net.Addr, error)
+	// Each calls fn for every server until it returns an error.
+	Each(fn func(net.Addr) error) error
+}
+
+// FailoverSelector is implemented by the selectors which can tell
+// where the keys of a server go when it is marked down.
+type FailoverSelector interface {
+	ServerSelector
+	// PickServers returns all the servers in the order
+	// they should be tried for the key.
+	PickServers(key string) ([]net.Addr, error)
+}
+
+// serverSetter is implemented by the selectors whose servers
+// can be set from the addresses given to the client.
+type serverSetter interface {
+	SetServers(addresses ...string) error
+}
+
+// protocol is implemented by the codecs which frame
+// the commands sent over a connection.
+type protocol interface {
+	store(cn *Connection, verb string, item *Item) error
+	// retrieve and retrieveMulti also update the expiration
+	// of the items to ttl when the verb is gat or gats.
+	retrieve(cn *Connection, verb string, key string, ttl time.Duration) (*Item, error)
+	retrieveMulti(cn *Connection, verb string, keys []string, ttl time.Duration) (map[string]*Item, error)
+	delete(cn *Connection, key string) error
+	touch(cn *Connection, key string, ttl time.Duration) error
+	// storeMulti, deleteMulti and touchMulti send all the commands at once
+	// and return the errors of the failed ones by their index.
+	storeMulti(cn *Connection, items []*Item) (map[int]error, error)
+	deleteMulti(cn *Connection, keys []string) (map[int]error, error)
+	touchMulti(cn *Connection, keys []string, ttl time.Duration) (map[int]error, error)
+	incrDecr(cn *Connection, verb string, key string, delta uint64) (uint64, error)
+	version(cn *Connection) (string, error)
+	flushAll(cn *Connection, delay time.Duration) error
+	verbosity(cn *Connection, level int) error
+	cacheMemLimit(cn *Connection, mb int) error
+	// shutdown returns nil once the server closed the connection.
+	shutdown(cn *Connection) error
+	// stats returns the statistics of the group, all the general ones
+	// when the group is empty.
+	stats(cn *Connection, group string) (map[string]string, error)
+	// auth authenticates a new connection with SASL PLAIN.
+	auth(cn *Connection, username, password string) error
 }